@@ -0,0 +1,266 @@
+package main
+
+import (
+	"PeerTester/peerTester"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jobRetention is how long the results of finished jobs can be fetched
+const jobRetention = time.Hour
+
+// Limits of requests over the HTTP API, which can reach the daemon from other hosts
+const (
+	maxRunningJobs = 4
+	maxAPITimeout  = 10 * time.Second
+)
+
+// Error codes only returned by the HTTP API
+const (
+	errorNotFound     = "not_found"
+	errorInternal     = "internal_error"
+	errorUnauthorized = "unauthorized"
+	errorBusy         = "busy"
+)
+
+// job is a test run started through the HTTP API
+type job struct {
+	ID       string                               `json:"id"`
+	Status   string                               `json:"status"`
+	Started  time.Time                            `json:"started"`
+	Finished *time.Time                           `json:"finished,omitempty"`
+	Results  map[string]*peerTester.IntFaceResult `json:"results,omitempty"`
+	Errors   []peerTester.ProtocolError           `json:"errors,omitempty"`
+}
+
+// apiServer serves on-demand tests and the last known results over HTTP
+type apiServer struct {
+	daemon *daemon
+	// token is required as bearer token in every request if set
+	token string
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	running int
+}
+
+func newAPIServer(d *daemon, token string) *apiServer {
+	return &apiServer{
+		daemon: d,
+		token:  token,
+		jobs:   make(map[string]*job),
+	}
+}
+
+func (a *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /tests", a.startTest)
+	mux.HandleFunc("GET /tests/{id}", a.getTest)
+	mux.HandleFunc("GET /interfaces/{name}", a.getInterface)
+	if a.token == "" {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAPIError(w, http.StatusUnauthorized, errorUnauthorized, "missing or wrong bearer token")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// apiAddress returns the address to serve the API on. Without a host, the API is only served on
+// localhost. Other hosts than loopback addresses require a token.
+func apiAddress(address string, hasToken bool) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", err
+	}
+	if host == "" {
+		return net.JoinHostPort("127.0.0.1", port), nil
+	}
+	if ip := net.ParseIP(host); (ip == nil || !ip.IsLoopback()) && host != "localhost" && !hasToken {
+		return "", fmt.Errorf("serving the API on %s requires -api-token-file", host)
+	}
+	return address, nil
+}
+
+// readAPIToken reads the bearer token from a file, or returns an empty token if no file is given
+func readAPIToken(fileName string) (string, error) {
+	if fileName == "" {
+		return "", nil
+	}
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return "", fmt.Errorf("%s is empty", fileName)
+	}
+	return token, nil
+}
+
+// serveAPI starts the HTTP API if an address is given
+func serveAPI(address, tokenFile string, d *daemon) {
+	if address == "" {
+		return
+	}
+	token, err := readAPIToken(tokenFile)
+	if err != nil {
+		fmt.Printf("Error reading API token: %s\n", err)
+		os.Exit(1)
+	}
+	if address, err = apiAddress(address, token != ""); err != nil {
+		fmt.Printf("Error serving API: %s\n", err)
+		os.Exit(1)
+	}
+	server := &http.Server{
+		Addr:              address,
+		Handler:           newAPIServer(d, token).handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil {
+			fmt.Printf("Error serving API: %s\n", err)
+			os.Exit(1)
+		}
+	}()
+}
+
+func (a *apiServer) startTest(w http.ResponseWriter, r *http.Request) {
+	request := &peerTester.Request{}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize+1))
+	if err == nil && len(body) > maxRequestSize {
+		err = errors.New("request too large")
+	}
+	if err == nil {
+		err = json.Unmarshal(body, request)
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, peerTester.ErrorInvalidRequest, err.Error())
+		return
+	}
+	if protocolErr := request.Validate(); protocolErr != nil {
+		writeAPIError(w, http.StatusBadRequest, protocolErr.Code, protocolErr.Message)
+		return
+	}
+	override, err := request.TestOptions()
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, peerTester.ErrorInvalidOption, err.Error())
+		return
+	}
+	if override.Timeout > maxAPITimeout {
+		writeAPIError(w, http.StatusBadRequest, peerTester.ErrorInvalidOption, fmt.Sprintf("timeout exceeds %s", maxAPITimeout))
+		return
+	}
+	if protocolErr := a.daemon.checkOverride(override); protocolErr != nil {
+		writeAPIError(w, http.StatusBadRequest, protocolErr.Code, protocolErr.Message)
+		return
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, errorInternal, err.Error())
+		return
+	}
+	j := &job{ID: id, Status: "running", Started: time.Now()}
+	a.mu.Lock()
+	if a.running >= maxRunningJobs {
+		a.mu.Unlock()
+		writeAPIError(w, http.StatusTooManyRequests, errorBusy, fmt.Sprintf("%d tests are already running", maxRunningJobs))
+		return
+	}
+	a.running++
+	a.expireJobs()
+	a.jobs[id] = j
+	snapshot := *j
+	a.mu.Unlock()
+
+	go func() {
+		response := a.daemon.handle(request)
+		finished := time.Now()
+		a.mu.Lock()
+		a.running--
+		j.Status = "done"
+		j.Finished = &finished
+		j.Results = response.Results
+		j.Errors = response.Errors
+		a.mu.Unlock()
+	}()
+
+	w.Header().Set("Location", "/tests/"+id)
+	writeJSON(w, http.StatusAccepted, snapshot)
+}
+
+func (a *apiServer) getTest(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	j, ok := a.jobs[r.PathValue("id")]
+	var snapshot job
+	if ok {
+		snapshot = *j
+	}
+	a.mu.Unlock()
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, errorNotFound, "unknown test id")
+		return
+	}
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+func (a *apiServer) getInterface(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	state, ok := a.daemon.store.State(name)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, errorNotFound, "interface has not been tested")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"name":    name,
+		"state":   state,
+		"history": a.daemon.store.History(name),
+	})
+}
+
+// expireJobs removes finished jobs older than jobRetention. The caller must hold a.mu.
+func (a *apiServer) expireJobs() {
+	for id, j := range a.jobs {
+		if j.Finished != nil && time.Since(*j.Finished) > jobRetention {
+			delete(a.jobs, id)
+		}
+	}
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func writeAPIError(w http.ResponseWriter, statusCode int, code, message string) {
+	writeJSON(w, statusCode, map[string]any{
+		"version": peerTester.ProtocolVersion,
+		"errors":  []peerTester.ProtocolError{{Code: code, Message: message}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(v)
+}
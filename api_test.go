@@ -0,0 +1,194 @@
+package main
+
+import (
+	"PeerTester/peerTester"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestAPI(token string) *apiServer {
+	d := &daemon{
+		store: peerTester.NewResultStore(),
+		opts:  peerTester.TestOptions{Sources4: []net.IP{net.ParseIP("172.20.0.1")}},
+	}
+	return newAPIServer(d, token)
+}
+
+func serveTestRequest(handler http.Handler, method, target, body, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestAPIAddress(t *testing.T) {
+	tests := []struct {
+		address  string
+		hasToken bool
+		want     string
+		wantErr  bool
+	}{
+		{":9517", false, "127.0.0.1:9517", false},
+		{"127.0.0.1:9517", false, "127.0.0.1:9517", false},
+		{"[::1]:9517", false, "[::1]:9517", false},
+		{"localhost:9517", false, "localhost:9517", false},
+		{"0.0.0.0:9517", false, "", true},
+		{"[fd42::1]:9517", false, "", true},
+		{"[fd42::1]:9517", true, "[fd42::1]:9517", false},
+		{"9517", false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			got, err := apiAddress(tt.address, tt.hasToken)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("apiAddress() error = %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("apiAddress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIToken(t *testing.T) {
+	handler := newTestAPI("secret").handler()
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"wrong", "guess", http.StatusUnauthorized},
+		{"right", "secret", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveTestRequest(handler, http.MethodGet, "/interfaces/wg0", "", tt.token)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestAPIStartTest(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		running  int
+		want     int
+		wantCode string
+	}{
+		{"invalid JSON", `{"version": 1`, 0, http.StatusBadRequest, peerTester.ErrorInvalidRequest},
+		{"unsupported version", `{"version": 99}`, 0, http.StatusBadRequest, peerTester.ErrorUnsupportedVersion},
+		{"timeout too long", `{"version": 1, "timeout": "1m"}`, 0, http.StatusBadRequest, peerTester.ErrorInvalidOption},
+		{"source not allowed", `{"version": 1, "src4": ["192.0.2.1"]}`, 0, http.StatusBadRequest, peerTester.ErrorInvalidOption},
+		{"too many running tests", `{"version": 1, "interfaces": ["pt-missing0"]}`, maxRunningJobs, http.StatusTooManyRequests, errorBusy},
+		{"accepted", `{"version": 1, "interfaces": ["pt-missing0"], "src4": ["172.20.0.1"], "timeout": "5s"}`, 0, http.StatusAccepted, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAPI("")
+			a.running = tt.running
+			w := serveTestRequest(a.handler(), http.MethodPost, "/tests", tt.body, "")
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			var response struct {
+				ID     string                     `json:"id"`
+				Errors []peerTester.ProtocolError `json:"errors"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantCode == "" {
+				if response.ID == "" || w.Header().Get("Location") != "/tests/"+response.ID {
+					t.Errorf("missing test id or location: %s", w.Body)
+				}
+			} else if len(response.Errors) != 1 || response.Errors[0].Code != tt.wantCode {
+				t.Errorf("errors = %v, want code %s", response.Errors, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestAPIGetTest(t *testing.T) {
+	a := newTestAPI("")
+	handler := a.handler()
+	if w := serveTestRequest(handler, http.MethodGet, "/tests/unknown", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unknown test: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	w := serveTestRequest(handler, http.MethodPost, "/tests", `{"version": 1, "interfaces": ["pt-missing0"]}`, "")
+	var started job
+	if err := json.Unmarshal(w.Body.Bytes(), &started); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w := serveTestRequest(handler, http.MethodGet, "/tests/"+started.ID, "", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+		}
+		var got job
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Status == "done" {
+			if len(got.Errors) != 1 || got.Errors[0].Code != peerTester.ErrorUnknownInterface {
+				t.Errorf("errors = %v, want %s", got.Errors, peerTester.ErrorUnknownInterface)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("test did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.running != 0 {
+		t.Errorf("running = %d after the test finished, want 0", a.running)
+	}
+}
+
+func TestAPIGetInterface(t *testing.T) {
+	a := newTestAPI("")
+	a.daemon.store.Record("wg0", &peerTester.IntFaceResult{V4: &peerTester.ListenResult{}, V6: &peerTester.ListenResult{}})
+	tests := []struct {
+		name string
+		want int
+	}{
+		{"wg0", http.StatusOK},
+		{"wg1", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveTestRequest(a.handler(), http.MethodGet, "/interfaces/"+tt.name, "", "")
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var got struct {
+				Name    string            `json:"name"`
+				History []json.RawMessage `json:"history"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != tt.name || len(got.History) != 1 {
+				t.Errorf("got %s, want %s with one history entry", w.Body, tt.name)
+			}
+		})
+	}
+}
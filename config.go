@@ -0,0 +1,95 @@
+package main
+
+import (
+	"PeerTester/peerTester"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// peerConfig holds the peer configuration file, which can be reloaded while running
+type peerConfig struct {
+	fileName string
+	current  atomic.Pointer[peerTester.Config]
+}
+
+// loadPeerConfig loads the configuration file. It returns nil if no file name was given.
+func loadPeerConfig(fileName string) *peerConfig {
+	if fileName == "" {
+		return nil
+	}
+	c := &peerConfig{fileName: fileName}
+	if err := c.reload(); err != nil {
+		fmt.Printf("Error loading config: %s\n", err)
+		os.Exit(1)
+	}
+	return c
+}
+
+func (c *peerConfig) reload() error {
+	config, err := peerTester.LoadConfig(c.fileName)
+	if err != nil {
+		return err
+	}
+	c.current.Store(config)
+	return nil
+}
+
+func (c *peerConfig) get() *peerTester.Config {
+	if c == nil {
+		return nil
+	}
+	return c.current.Load()
+}
+
+// apply adds the per-interface options of the configuration file to opts
+func (c *peerConfig) apply(opts peerTester.TestOptions, intFaces []net.Interface) peerTester.TestOptions {
+	config := c.get()
+	if config == nil {
+		return opts
+	}
+	return config.Apply(opts, intFaces)
+}
+
+// sources returns the per-peer source addresses
+func (c *peerConfig) sources() []net.IP {
+	config := c.get()
+	if config == nil {
+		return nil
+	}
+	return config.Sources()
+}
+
+// destinations returns the per-peer destination addresses that need a listener
+func (c *peerConfig) destinations() []net.IP {
+	config := c.get()
+	if config == nil {
+		return nil
+	}
+	return config.Destinations()
+}
+
+// findInterfaces returns the interfaces chosen by the selector. Without include patterns, these
+// are all interfaces, or the ones matching a peer entry if a configuration file is loaded.
+func findInterfaces(selector *peerTester.InterfaceSelector, config *peerConfig) ([]net.Interface, error) {
+	intFaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	if cfg := config.get(); cfg != nil && len(selector.Include) == 0 {
+		intFaces = cfg.Interfaces(intFaces)
+	}
+	// The peer entries tell which ethernet links have a known peer
+	withConfig := *selector
+	withConfig.Options = config.apply(selector.Options, intFaces)
+	selected, unmatched, err := withConfig.Select(intFaces)
+	if err != nil {
+		return nil, err
+	}
+	if len(unmatched) != 0 {
+		return nil, fmt.Errorf("no interface matching %s", strings.Join(unmatched, ", "))
+	}
+	return selected, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"PeerTester/peerTester"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"slices"
+	"time"
+)
+
+// maxRequestSize limits the length of a single request line on the daemon socket
+const maxRequestSize = 64 * 1024
+
+// daemon answers test requests using a shared tester
+type daemon struct {
+	tester   *peerTester.Tester
+	store    *peerTester.ResultStore
+	selector *peerTester.InterfaceSelector
+	config   *peerConfig
+	dstIp    net.IP
+	dstIp6   net.IP
+	opts     peerTester.TestOptions
+	runLog   *peerTester.RunLog
+}
+
+// serveConn reads newline-delimited JSON requests from the connection and writes one JSON
+// response line for every request
+func (d *daemon) serveConn(conn net.Conn) {
+	defer func(conn net.Conn) {
+		_ = conn.Close()
+	}(conn)
+
+	reader := bufio.NewReaderSize(conn, 4096)
+	encoder := json.NewEncoder(conn)
+	for {
+		err := conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		if err != nil {
+			fmt.Printf("Error setting unix socket read deadline: %s\n", err)
+			return
+		}
+		line, err := readLine(reader)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				fmt.Printf("Error reading from unix socket: %s\n", err)
+			}
+			return
+		}
+		if len(line) == 0 {
+			continue
+		}
+
+		request := &peerTester.Request{}
+		var response *peerTester.Response
+		if err := json.Unmarshal(line, request); err != nil {
+			response = peerTester.NewResponse(request)
+			response.AddError(peerTester.ErrorInvalidRequest, "", err.Error())
+		} else {
+			response = d.handle(request)
+		}
+		if err := encoder.Encode(response); err != nil {
+			fmt.Printf("Error writing to unix socket: %s\n", err)
+			return
+		}
+	}
+}
+
+func readLine(reader *bufio.Reader) ([]byte, error) {
+	line := make([]byte, 0)
+	for {
+		part, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, part...)
+		if len(line) > maxRequestSize {
+			return nil, fmt.Errorf("request exceeds %d bytes", maxRequestSize)
+		}
+		if !isPrefix {
+			return line, nil
+		}
+	}
+}
+
+// handle runs the tests of a request
+func (d *daemon) handle(request *peerTester.Request) *peerTester.Response {
+	response := peerTester.NewResponse(request)
+	if err := request.Validate(); err != nil {
+		response.Errors = append(response.Errors, *err)
+		return response
+	}
+
+	override, err := request.TestOptions()
+	if err != nil {
+		response.AddError(peerTester.ErrorInvalidOption, "", err.Error())
+		return response
+	}
+	if err := d.checkOverride(override); err != nil {
+		response.Errors = append(response.Errors, *err)
+		return response
+	}
+
+	var intFaces []net.Interface
+	if len(request.Interfaces) == 0 {
+		intFaces, err = findInterfaces(d.selector, d.config)
+		if err != nil {
+			response.AddError(peerTester.ErrorInvalidRequest, "", err.Error())
+			return response
+		}
+	} else {
+		all, err := net.Interfaces()
+		if err != nil {
+			response.AddError(peerTester.ErrorInvalidRequest, "", err.Error())
+			return response
+		}
+		var errs []peerTester.ProtocolError
+		intFaces, errs = request.SelectInterfaces(all)
+		response.Errors = append(response.Errors, errs...)
+	}
+	if len(intFaces) == 0 {
+		return response
+	}
+
+	opts := d.config.apply(d.opts, intFaces).WithOverride(intFaces, override)
+	response.Results = d.tester.PerformTests(intFaces, d.dstIp, d.dstIp6, opts)
+	if !peerTester.OutputJSON {
+		for _, name := range slices.Sorted(maps.Keys(response.Results)) {
+			peerTester.PrintResultLine(name, response.Results[name])
+		}
+	}
+	d.store.RecordAll(response.Results)
+	dstIp, dstIp6 := d.dstIp, d.dstIp6
+	if override.Destination4 != nil {
+		dstIp = override.Destination4
+	}
+	if override.Destination6 != nil {
+		dstIp6 = override.Destination6
+	}
+	recordRun(d.runLog, dstIp, dstIp6, response.Results)
+	return response
+}
+
+// checkOverride returns an error if a request uses addresses the operator did not configure
+func (d *daemon) checkOverride(override peerTester.TestOptions) *peerTester.ProtocolError {
+	// Requests may not open listeners, which would stay open after the request
+	for _, ip := range []net.IP{override.Destination4, override.Destination6} {
+		if ip != nil && !d.tester.Listening(ip) {
+			return &peerTester.ProtocolError{Code: peerTester.ErrorListen, Message: fmt.Sprintf("not listening on %s, only configured destinations can be used", ip)}
+		}
+	}
+	// Requests may not send probes from arbitrary addresses
+	allowed := append(d.opts.AllowedSources(), d.config.sources()...)
+	for _, ip := range append(slices.Clone(override.Sources4), override.Sources6...) {
+		if !slices.ContainsFunc(allowed, ip.Equal) {
+			return &peerTester.ProtocolError{Code: peerTester.ErrorInvalidOption, Message: fmt.Sprintf("source %s is not allowed, only configured sources can be used", ip)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"PeerTester/peerTester"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// recordRun appends the results of a run to the run log, if enabled
+func recordRun(runLog *peerTester.RunLog, dstIp, dstIp6 net.IP, resultMap map[string]*peerTester.IntFaceResult) {
+	if runLog == nil || len(resultMap) == 0 {
+		return
+	}
+	if _, err := runLog.Append(dstIp, dstIp6, resultMap); err != nil && !peerTester.OutputJSON {
+		fmt.Printf("Error recording run in %s: %s\n", runLog.Path, err)
+	}
+}
+
+// runHistoryCommand prints the recorded results of an interface: peertester history <interface>
+func runHistoryCommand(args []string) {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	historyFile := flags.String("history-file", peerTester.DefaultRunLog, "run log to read")
+	jsonOutput := flags.Bool("json", false, "output as JSON")
+	limit := flags.Int("n", 0, "only show the last n runs")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Println("Usage: peertester history [-history-file file] [-json] [-n count] <interface>")
+		os.Exit(1)
+	}
+	name := flags.Arg(0)
+
+	runs := readRunLog(*historyFile)
+	type entry struct {
+		ID     int                       `json:"id"`
+		Time   time.Time                 `json:"time"`
+		Result *peerTester.IntFaceResult `json:"result"`
+	}
+	entries := make([]entry, 0)
+	for _, run := range runs {
+		if result, ok := run.Results[name]; ok {
+			entries = append(entries, entry{ID: run.ID, Time: run.Time, Result: result})
+		}
+	}
+	if *limit > 0 && len(entries) > *limit {
+		entries = entries[len(entries)-*limit:]
+	}
+
+	if *jsonOutput {
+		printJSON(entries)
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Printf("No runs recorded for %s\n", name)
+		return
+	}
+	for _, e := range entries {
+		fmt.Printf("#%-5d %s ", e.ID, e.Time.Local().Format(time.DateTime))
+		peerTester.PrintResultLine(name, e.Result)
+	}
+}
+
+// runDiffCommand prints the changes between two runs: peertester diff <runA> <runB>. Without
+// arguments, the last two runs are compared.
+func runDiffCommand(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	historyFile := flags.String("history-file", peerTester.DefaultRunLog, "run log to read")
+	jsonOutput := flags.Bool("json", false, "output as JSON")
+	_ = flags.Parse(args)
+	references := flags.Args()
+	if len(references) == 0 {
+		references = []string{"last~1", "last"}
+	}
+	if len(references) != 2 {
+		fmt.Println("Usage: peertester diff [-history-file file] [-json] <runA> <runB>")
+		fmt.Println("Runs are given by ID, or as 'last' and 'last~n' for the run n runs before the last")
+		os.Exit(1)
+	}
+
+	runs := readRunLog(*historyFile)
+	a, err := peerTester.FindRun(runs, references[0])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	b, err := peerTester.FindRun(runs, references[1])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	changes := peerTester.DiffRuns(a, b)
+
+	if *jsonOutput {
+		printJSON(struct {
+			A       int                    `json:"a"`
+			B       int                    `json:"b"`
+			Changes []peerTester.RunChange `json:"changes"`
+		}{a.ID, b.ID, changes})
+		return
+	}
+	fmt.Printf("Run #%d (%s) -> run #%d (%s)\n", a.ID, a.Time.Local().Format(time.DateTime), b.ID, b.Time.Local().Format(time.DateTime))
+	if len(changes) == 0 {
+		fmt.Println("No changes")
+	}
+	for _, change := range changes {
+		fmt.Printf("[%-10s]", change.Interface)
+		if change.Family != "" {
+			fmt.Printf(" %s", change.Family)
+		}
+		fmt.Printf(" %s", change.Kind)
+		if change.Before != "" || change.After != "" {
+			fmt.Printf(": %s -> %s", change.Before, change.After)
+		}
+		fmt.Println()
+	}
+}
+
+func readRunLog(path string) []peerTester.Run {
+	runs, err := peerTester.NewRunLog(path).Runs()
+	if err != nil {
+		fmt.Printf("Error reading run log: %s\n", err)
+		os.Exit(1)
+	}
+	return runs
+}
+
+func printJSON(v any) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		fmt.Printf("Error serializing to JSON: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Print(string(js))
+}
@@ -14,17 +14,111 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "history":
+			runHistoryCommand(os.Args[2:])
+			return
+		case "diff":
+			runDiffCommand(os.Args[2:])
+			return
+		}
+	}
+
 	destIPv4Str := flag.String("dst4", "", "destination IPv4 address "+
 		"(the address this host can be reached from) or CIDR to find address from 'lo'")
 	destIPv6Str := flag.String("dst6", "", "destination IPv6 address "+
 		"(the address this host can be reached from) or CIDR to find address from 'lo'")
-	targetInterface := flag.String("interface", "", "optional comma-separated target interface(s). "+
-		"Use '-' to read from stdin. If not specified, packets are sent on all interfaces")
-	jsonOutput := flag.Bool("json", false, "output as JSON")
-	daemon := flag.Bool("daemon", false, "run as a daemon and accept interface lists via unix socket")
+	targetInterface := flag.String("interface", "", "optional comma-separated target interface names or patterns "+
+		"('dn42*', '/^wg[0-9]+$/'), prefix with '!' to exclude. Use '-' to read from stdin. "+
+		"If not specified, packets are sent on all interfaces")
+	interfaceTypes := flag.String("interface-type", "", "optional comma-separated link types to test "+
+		"(ether, none, gre, ip6gre, sit, ipip, ip6tnl)")
+	interfaceDrivers := flag.String("interface-driver", "", "optional comma-separated link kinds or drivers to test "+
+		"(e.g. wireguard, gre, veth)")
+	interfaceStates := flag.String("interface-state", "", "optional comma-separated operational states to test "+
+		"(e.g. up, unknown)")
+	birdSocket := flag.String("bird-socket", "", "optional BIRD control socket to annotate results with BGP sessions "+
+		"(e.g. '"+peerTester.DefaultBIRDSocket+"')")
+	bgpEstablished := flag.Bool("bgp-established", false, "only test interfaces with an established BGP session in BIRD")
+	skipUntestable := flag.Bool("skip-untestable", false, "quietly skip interfaces that are down, have an unsupported link type or are ethernet links without a known peer")
+	onlyIPv4 := flag.Bool("4", false, "only test IPv4")
+	onlyIPv6 := flag.Bool("6", false, "only test IPv6")
+	detectFamilies := flag.Bool("detect-families", true, "report address families without an address or route on the interface as not configured instead of testing them")
+	jsonOutput := flag.Bool("json", false, "output as JSON, same as -format json")
+	outputFormat := flag.String("format", string(peerTester.FormatText), "output format of the results: text, json, csv, markdown, junit or tap")
+	daemon := flag.Bool("daemon", false, "run as a daemon and accept JSON test requests via unix socket")
+	parallel := flag.Int("parallel", peerTester.Concurrency, "maximum number of interfaces to test concurrently")
+	defaultOptions := peerTester.DefaultTestOptions()
+	probeCount := flag.Int("count", defaultOptions.ProbeCount, "number of probes to send per address family")
+	probeInterval := flag.Duration("interval", defaultOptions.ProbeInterval, "interval between probes")
+	timeout := flag.Duration("timeout", defaultOptions.Timeout, "time to wait for replies after the last probe was sent")
+	expectedHops := flag.Int("expected-hops", 1, "number of routers the probes are expected to pass, including the peer's router")
+	traceroute := flag.Bool("traceroute", false, "run a traceroute for address families that time out or arrive with an unexpected TTL")
+	pathMTU := flag.Bool("path-mtu", false, "search the largest packet size that comes back through the peer")
+	dscp := flag.Int("dscp", 0, "DSCP value (0-63) to mark the probes with")
+	ecn := flag.Int("ecn", 0, "ECN codepoint (0-3) to mark the probes with, e.g. 2 for ECT(0)")
+	monitor := flag.Bool("monitor", false, "keep running and re-test the selected interfaces periodically")
+	defaultMonitorOptions := peerTester.DefaultMonitorOptions()
+	monitorInterval := flag.Duration("monitor-interval", defaultMonitorOptions.Interval, "interval between tests of an interface in monitor mode")
+	monitorJitter := flag.Duration("monitor-jitter", defaultMonitorOptions.Jitter, "maximum random delay added to each test in monitor mode")
+	monitorRetry := flag.Duration("monitor-retry", defaultMonitorOptions.RetryInterval, "initial retry interval for failing interfaces in monitor mode, doubled on every failure")
+	sources4 := flag.String("src4", "", "optional comma-separated source IPv4 address(es) of the probes (default "+peerTester.SourceIPv4.String()+")")
+	sources6 := flag.String("src6", "", "optional comma-separated source IPv6 address(es) of the probes (default "+peerTester.SourceIPv6.String()+")")
+	interfaceSources := flag.String("src-interface", "", "optional per-interface source addresses, "+
+		"e.g. 'wg0=172.20.1.1,fd42::1;wg1=172.21.1.1'")
+	port := flag.Int("port", peerTester.DefaultTesterOptions().Port, "UDP destination port of the probes and port to listen on")
+	sourcePort := flag.Int("src-port", 0, "UDP source port of the probes (default same as -port)")
+	randomSourcePort := flag.Bool("random-src-port", false, "use a random UDP source port for every probe")
+	listenAddresses := flag.String("listen", "", "optional comma-separated addresses to listen on, or 'any' for all addresses "+
+		"(default the -dst4 and -dst6 addresses)")
+	configFile := flag.String("config", "", "optional JSON peer configuration file")
+	hookURLs := flag.String("hook-url", "", "optional comma-separated webhook URLs receiving a JSON POST request "+
+		"when the status of an interface changes, in daemon and monitor mode")
+	hookExecs := flag.String("hook-exec", "", "optional comma-separated executables run with the JSON event on stdin "+
+		"when the status of an interface changes, in daemon and monitor mode")
+	hookHoldDown := flag.Duration("hook-hold-down", 30*time.Second, "time a status change must last before the hooks are run")
+	historyFile := flag.String("history-file", "", "optional file every CLI run and daemon request is appended to (e.g. '"+peerTester.DefaultRunLog+"'), "+
+		"not used in monitor mode, read by 'peertester history <interface>' and 'peertester diff <runA> <runB>'")
+	historyMaxSize := flag.Int64("history-max-size", peerTester.DefaultRunLogMaxSize>>20, "size in MiB at which the history file "+
+		"is rotated to <file>.1, 0 to never rotate it")
+	metricsListen := flag.String("metrics-listen", "", "address to serve Prometheus metrics on (e.g. ':9516') in daemon and monitor mode")
+	apiListen := flag.String("api-listen", "", "address to serve the HTTP API on in daemon mode, on localhost if no host is given (e.g. ':9517')")
+	apiTokenFile := flag.String("api-token-file", "", "optional file holding the bearer token required by the HTTP API, needed to serve it on other addresses than localhost")
 	flag.Parse()
+	notifier := newNotifier(*hookURLs, *hookExecs, *hookHoldDown)
+	var runLog *peerTester.RunLog
+	if *historyFile != "" {
+		runLog = peerTester.NewRunLog(*historyFile)
+		runLog.MaxSize = *historyMaxSize << 20
+	}
 
-	peerTester.OutputJSON = *jsonOutput
+	format, err := peerTester.ParseFormat(*outputFormat)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *jsonOutput {
+		format = peerTester.FormatJSON
+	}
+	// Diagnostic messages would corrupt machine-readable output
+	peerTester.OutputJSON = format != peerTester.FormatText
+	peerTester.Concurrency = *parallel
+
+	config := loadPeerConfig(*configFile)
+	selector := parseSelector(*targetInterface, *interfaceTypes, *interfaceDrivers, *interfaceStates, *skipUntestable)
+	selector.BGPEstablished = *bgpEstablished
+	if *birdSocket != "" {
+		selector.BIRD = peerTester.NewBIRDClient(*birdSocket)
+	}
+	if cfg := config.get(); cfg != nil {
+		if *destIPv4Str == "" {
+			*destIPv4Str = cfg.Dst4
+		}
+		if *destIPv6Str == "" {
+			*destIPv6Str = cfg.Dst6
+		}
+	}
 
 	var dstIp, dstIp6 net.IP
 
@@ -42,14 +136,10 @@ func main() {
 		if !peerTester.OutputJSON {
 			fmt.Println("Using destination IP:", dstIp.String())
 		}
-	} else {
+	} else if *destIPv4Str != "" {
 		dstIp = net.ParseIP(*destIPv4Str)
 		if dstIp == nil {
-			if *destIPv4Str == "" {
-				fmt.Println("No destination IPv4 address entered")
-			} else {
-				fmt.Println("Invalid IPv4 address entered")
-			}
+			fmt.Println("Invalid IPv4 address entered")
 			os.Exit(1)
 		}
 	}
@@ -68,91 +158,145 @@ func main() {
 		if !peerTester.OutputJSON {
 			fmt.Println("Using destination IP:", dstIp6.String())
 		}
-	} else {
+	} else if *destIPv6Str != "" {
 		dstIp6 = net.ParseIP(*destIPv6Str)
 		if dstIp6 == nil {
-			if *destIPv4Str == "" {
-				fmt.Println("No destination IPv6 address entered")
-			} else {
-				fmt.Println("Invalid IPv6 address entered")
-			}
+			fmt.Println("Invalid IPv6 address entered")
 			os.Exit(1)
 		}
 	}
 
-	if *daemon {
-		runAsDaemon(dstIp, dstIp6)
-	} else {
-		runAsCli(dstIp, dstIp6, *targetInterface)
+	families := peerTester.FamilyAll
+	if *onlyIPv4 != *onlyIPv6 {
+		if *onlyIPv4 {
+			families = peerTester.FamilyIPv4
+		} else {
+			families = peerTester.FamilyIPv6
+		}
+	}
+	if families&peerTester.FamilyIPv4 != 0 && dstIp == nil && (*onlyIPv4 || dstIp6 == nil) {
+		fmt.Println("No destination IPv4 address entered")
+		os.Exit(1)
+	}
+	if families&peerTester.FamilyIPv6 != 0 && dstIp6 == nil && (*onlyIPv6 || dstIp == nil) {
+		fmt.Println("No destination IPv6 address entered")
+		os.Exit(1)
 	}
-}
 
-func runAsCli(dstIp, dstIp6 net.IP, targetInterface string) {
-	var intFaces = make([]net.Interface, 0)
-	if targetInterface != "" {
-		if targetInterface == "-" {
-			_, err := fmt.Scanln(&targetInterface)
-			if err != nil {
-				fmt.Printf("Error reading from stdin: %s\n", err)
+	if err := peerTester.ValidateMarking(*dscp, *ecn); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	opts := peerTester.TestOptions{
+		ProbeCount:          *probeCount,
+		ProbeInterval:       *probeInterval,
+		Timeout:             *timeout,
+		SourcePort:          *sourcePort,
+		RandomSourcePort:    *randomSourcePort,
+		Families:            families,
+		ExpectedHops:        *expectedHops,
+		Traceroute:          *traceroute,
+		PathMTU:             *pathMTU,
+		DSCP:                *dscp,
+		ECN:                 *ecn,
+		SkipFamilyDetection: !*detectFamilies,
+		BIRD:                selector.BIRD,
+	}
+
+	if opts.Sources4, err = parseFamilyList(*sources4, true); err != nil {
+		fmt.Printf("Error parsing -src4: %s\n", err)
+		os.Exit(1)
+	}
+	if opts.Sources6, err = parseFamilyList(*sources6, false); err != nil {
+		fmt.Printf("Error parsing -src6: %s\n", err)
+		os.Exit(1)
+	}
+	if *interfaceSources != "" {
+		opts.Overrides = make(map[string]peerTester.TestOptions)
+		for _, entry := range strings.Split(*interfaceSources, ";") {
+			name, list, found := strings.Cut(entry, "=")
+			if !found {
+				fmt.Printf("Invalid per-interface source entry: %s\n", entry)
 				os.Exit(1)
 			}
-		}
-
-		intFaceListInput := strings.Split(targetInterface, ",")
-		for _, intFaceInput := range intFaceListInput {
-			intFace, err := net.InterfaceByName(intFaceInput)
+			override := opts.Overrides[name]
+			override.Sources4, override.Sources6, err = parseSourceList(list)
 			if err != nil {
-				fmt.Printf("Error finding interface %s: %s\n", intFaceInput, err)
+				fmt.Printf("Error parsing source addresses for %s: %s\n", name, err)
 				os.Exit(1)
 			}
-			intFaces = append(intFaces, *intFace)
-		}
-	} else {
-		var err error
-		intFaces, err = net.Interfaces()
-		if err != nil {
-			fmt.Printf("Error getting interfaces: %s\n", err)
-			os.Exit(1)
+			opts.Overrides[name] = override
 		}
 	}
-	resultMap := peerTester.PerformTests(intFaces, dstIp, dstIp6)
+	selector.Options = opts
 
-	if peerTester.OutputJSON {
-		js, err := json.Marshal(resultMap)
+	testerOpts := peerTester.TesterOptions{
+		Port:            *port,
+		ListenAddresses: make([]net.IP, 0, 2),
+	}
+	for _, ip := range []net.IP{dstIp, dstIp6} {
+		if ip != nil {
+			testerOpts.ListenAddresses = append(testerOpts.ListenAddresses, ip)
+		}
+	}
+	if *listenAddresses == "any" {
+		testerOpts.ListenAddresses = nil
+	} else if *listenAddresses != "" {
+		listen4, listen6, err := parseSourceList(*listenAddresses)
 		if err != nil {
-			fmt.Printf("Error serializing map to JSON: %s\n", err)
+			fmt.Printf("Error parsing listen addresses: %s\n", err)
 			os.Exit(1)
 		}
-		fmt.Print(string(js))
-		return
+		testerOpts.ListenAddresses = append(listen4, listen6...)
+	}
+	if *listenAddresses != "any" {
+		testerOpts.ListenAddresses = append(testerOpts.ListenAddresses, config.destinations()...)
 	}
 
-	// Human-readable output
-	if len(resultMap) > 0 {
-		fmt.Println("-- Failed interface summary --")
-		for intFaceName, result := range resultMap {
-			var errors = make([]string, 0)
-			if result.V4.Status != peerTester.OK {
-				errors = append(errors, fmt.Sprintf("Error (v4): %s", result.V4.ErrorText))
-			}
-			if result.V6.Status != peerTester.OK {
-				errors = append(errors, fmt.Sprintf("Error (v6): %s", result.V6.ErrorText))
-			}
-			if len(errors) != 0 {
-				fmt.Printf("[%-10s] %s", intFaceName, strings.Join(errors, " "))
-				fmt.Println()
-			}
-		}
+	if *daemon {
+		runAsDaemon(dstIp, dstIp6, selector, config, testerOpts, opts, runLog, notifier, *metricsListen, *apiListen, *apiTokenFile)
+	} else if *monitor {
+		runAsMonitor(dstIp, dstIp6, selector, config, *metricsListen, testerOpts, opts, notifier, peerTester.MonitorOptions{
+			Interval:      *monitorInterval,
+			Jitter:        *monitorJitter,
+			RetryInterval: *monitorRetry,
+		})
+	} else {
+		runAsCli(dstIp, dstIp6, selector, config, testerOpts, opts, runLog, format)
+	}
+}
+
+func runAsCli(dstIp, dstIp6 net.IP, selector *peerTester.InterfaceSelector, config *peerConfig, testerOpts peerTester.TesterOptions, opts peerTester.TestOptions, runLog *peerTester.RunLog, format peerTester.Format) {
+	intFaces := selectInterfaces(selector, config)
+	tester := newTester(testerOpts)
+	meta := peerTester.RunMetadata{Start: time.Now(), Dst4: dstIp, Dst6: dstIp6}
+	resultMap := tester.PerformTests(intFaces, dstIp, dstIp6, config.apply(opts, intFaces))
+	meta.End = time.Now()
+	tester.Close()
+	recordRun(runLog, dstIp, dstIp6, resultMap)
+
+	if err := peerTester.WriteResults(os.Stdout, format, resultMap, meta); err != nil {
+		fmt.Printf("Error writing results: %s\n", err)
+		os.Exit(1)
 	}
 }
 
-func runAsDaemon(dstIp, dstIp6 net.IP) {
+func runAsDaemon(dstIp, dstIp6 net.IP, selector *peerTester.InterfaceSelector, config *peerConfig, testerOpts peerTester.TesterOptions, opts peerTester.TestOptions, runLog *peerTester.RunLog, notifier *peerTester.Notifier, metricsListen, apiListen, apiTokenFile string) {
+	tester := newTester(testerOpts)
+
 	socket, err := net.Listen("unix", "peer-tester.sock")
 	if err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
 	}
 
+	store := peerTester.NewResultStore()
+	if notifier != nil {
+		store.OnStatusChange = notifier.StatusChanged
+	}
+	serveMetrics(metricsListen, store)
+
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
@@ -161,47 +305,196 @@ func runAsDaemon(dstIp, dstIp6 net.IP) {
 		os.Exit(0)
 	}()
 
+	if config != nil {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := config.reload(); err != nil {
+					fmt.Printf("Error reloading config: %s\n", err)
+					continue
+				}
+				if err := tester.Listen(config.destinations()); err != nil {
+					fmt.Printf("Error listening on new destination addresses: %s\n", err)
+				}
+				fmt.Println("Reloaded config")
+			}
+		}()
+	}
+
+	d := &daemon{
+		tester:   tester,
+		store:    store,
+		selector: selector,
+		config:   config,
+		dstIp:    dstIp,
+		dstIp6:   dstIp6,
+		opts:     opts,
+		runLog:   runLog,
+	}
+	serveAPI(apiListen, apiTokenFile, d)
 	for {
 		conn, err := socket.Accept()
 		if err != nil {
 			fmt.Printf("Error unix socket accepting connection: %s\n", err)
 			os.Exit(1)
 		}
-		go func(conn net.Conn) {
-			defer func(conn net.Conn) {
-				_ = conn.Close()
-			}(conn)
+		go d.serveConn(conn)
+	}
+}
+
+// newNotifier returns the notifier running the configured hooks, or nil if there are none
+func newNotifier(urls, executables string, holdDown time.Duration) *peerTester.Notifier {
+	hooks := make([]peerTester.Hook, 0)
+	for _, url := range splitList(urls) {
+		hooks = append(hooks, &peerTester.WebhookHook{URL: url})
+	}
+	for _, path := range splitList(executables) {
+		hooks = append(hooks, &peerTester.ExecHook{Path: path})
+	}
+	if len(hooks) == 0 {
+		return nil
+	}
+	notifier := peerTester.NewNotifier(hooks, holdDown)
+	notifier.OnError = func(hook peerTester.Hook, err error) {
+		fmt.Printf("Error running hook %s: %s\n", hook, err)
+	}
+	return notifier
+}
+
+func parseSelector(targetInterface, types, drivers, states string, skipUntestable bool) *peerTester.InterfaceSelector {
+	if targetInterface == "-" {
+		_, err := fmt.Scanln(&targetInterface)
+		if err != nil {
+			fmt.Printf("Error reading from stdin: %s\n", err)
+			os.Exit(1)
+		}
+	}
 
-			err = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
-			if err != nil {
-				fmt.Printf("Error setting unix socket read deadline: %s\n", err)
-				return
-			}
-			buf := make([]byte, 10000)
-			numRead, err := conn.Read(buf)
+	selector := &peerTester.InterfaceSelector{
+		Types:          splitList(types),
+		Drivers:        splitList(drivers),
+		OperStates:     splitList(states),
+		SkipUntestable: skipUntestable,
+	}
+	selector.Include, selector.Exclude = peerTester.ParseInterfacePatterns(targetInterface)
+	return selector
+}
+
+func selectInterfaces(selector *peerTester.InterfaceSelector, config *peerConfig) []net.Interface {
+	intFaces, err := findInterfaces(selector, config)
+	if err != nil {
+		fmt.Printf("Error finding interfaces: %s\n", err)
+		os.Exit(1)
+	}
+	return intFaces
+}
+
+// splitList splits a comma-separated list, ignoring empty entries
+func splitList(list string) []string {
+	entries := make([]string, 0)
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func runAsMonitor(dstIp, dstIp6 net.IP, selector *peerTester.InterfaceSelector, config *peerConfig, metricsListen string, testerOpts peerTester.TesterOptions, opts peerTester.TestOptions, notifier *peerTester.Notifier, monitorOpts peerTester.MonitorOptions) {
+	intFaces := selectInterfaces(selector, config)
+
+	tester := newTester(testerOpts)
+	monitor := peerTester.NewMonitor(tester, intFaces, selector, dstIp, dstIp6, config.apply(opts, intFaces), monitorOpts)
+	monitor.Store.OnStatusChange = func(name string, previous *peerTester.IntFaceResult, state peerTester.InterfaceState) {
+		if notifier != nil {
+			notifier.StatusChanged(name, previous, state)
+		}
+		if peerTester.OutputJSON {
+			js, err := json.Marshal(map[string]any{
+				"Interface":  name,
+				"LastChange": state.LastChange,
+				"Result":     state.Result,
+			})
 			if err != nil {
-				fmt.Printf("Error reading from unix socket: %s\n", err)
+				fmt.Printf("Error serializing result to JSON: %s\n", err)
 				return
 			}
-			list := string(buf[:numRead])
-
-			intFaces := make([]net.Interface, 0)
-			for _, intFaceInput := range strings.Split(list, ",") {
-				intFace, err := net.InterfaceByName(intFaceInput)
-				if err != nil {
-					fmt.Printf("Error finding interface %s: %s\n", intFaceInput, err)
-					_, _ = conn.Write([]byte("error"))
-				}
-				intFaces = append(intFaces, *intFace)
-			}
+			fmt.Println(string(js))
+			return
+		}
+		fmt.Printf("%s ", state.LastChange.Format(time.DateTime))
+		peerTester.PrintResultLine(name, state.Result)
+	}
+	serveMetrics(metricsListen, monitor.Store)
 
-			resultMap := peerTester.PerformTests(intFaces, dstIp, dstIp6)
-			js, err := json.Marshal(resultMap)
-			if err != nil {
-				fmt.Printf("Error serializing map to JSON: %s\n", err)
-				os.Exit(1)
-			}
-			_, _ = conn.Write(js)
-		}(conn)
+	stop := make(chan struct{})
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		close(stop)
+	}()
+
+	monitor.Run(stop)
+	tester.Close()
+}
+
+func newTester(testerOpts peerTester.TesterOptions) *peerTester.Tester {
+	tester, err := peerTester.NewTester(testerOpts)
+	if err != nil {
+		fmt.Printf("Error starting listener: %s\n", err)
+		os.Exit(1)
+	}
+	return tester
+}
+
+func serveMetrics(address string, store *peerTester.ResultStore) {
+	if address == "" {
+		return
+	}
+	go func() {
+		if err := peerTester.ServeMetrics(address, store); err != nil {
+			fmt.Printf("Error serving metrics: %s\n", err)
+			os.Exit(1)
+		}
+	}()
+}
+
+// parseSourceList parses a comma-separated list of IPv4 and IPv6 addresses
+func parseSourceList(list string) (sources4 []net.IP, sources6 []net.IP, err error) {
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, nil, fmt.Errorf("invalid IP address %s", entry)
+		}
+		if ip.To4() != nil {
+			sources4 = append(sources4, ip)
+		} else {
+			sources6 = append(sources6, ip)
+		}
+	}
+	return sources4, sources6, nil
+}
+
+// parseFamilyList parses a comma-separated list of addresses that must all be of one family
+func parseFamilyList(list string, isV4 bool) ([]net.IP, error) {
+	sources4, sources6, err := parseSourceList(list)
+	if err != nil {
+		return nil, err
+	}
+	if isV4 {
+		if len(sources6) != 0 {
+			return nil, fmt.Errorf("invalid IPv4 address %s", sources6[0])
+		}
+		return sources4, nil
+	}
+	if len(sources4) != 0 {
+		return nil, fmt.Errorf("invalid IPv6 address %s", sources4[0])
 	}
+	return sources6, nil
 }
@@ -0,0 +1,228 @@
+package peerTester
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBIRDSocket is the default path of the BIRD control socket
+const DefaultBIRDSocket = "/run/bird/bird.ctl"
+
+// birdCacheTime is how long the sessions read from BIRD are reused
+const birdCacheTime = 5 * time.Second
+
+// BGPSession is a BGP protocol of BIRD
+type BGPSession struct {
+	Protocol        string
+	State           string
+	NeighborAddress net.IP
+	NeighborAS      uint32
+	// Interface is only set if the neighbor address is scoped to an interface, as for link-local neighbors
+	Interface string
+}
+
+// Established reports whether the session is up
+func (s BGPSession) Established() bool {
+	return s.State == "Established"
+}
+
+// BIRDClient reads the BGP sessions from the BIRD control socket
+type BIRDClient struct {
+	SocketPath string
+
+	mu       sync.Mutex
+	sessions []BGPSession
+	readAt   time.Time
+}
+
+func NewBIRDClient(socketPath string) *BIRDClient {
+	return &BIRDClient{SocketPath: socketPath}
+}
+
+// Sessions returns the BGP sessions of BIRD. Results are cached for a few seconds so that
+// concurrent tests do not all query BIRD.
+func (c *BIRDClient) Sessions() ([]BGPSession, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sessions != nil && time.Since(c.readAt) < birdCacheTime {
+		return c.sessions, nil
+	}
+
+	conn, err := net.DialTimeout("unix", c.SocketPath, 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer func(conn net.Conn) {
+		_ = conn.Close()
+	}(conn)
+	if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	// Greeting: 0001 BIRD x.y.z ready.
+	if _, err := readBIRDReply(reader); err != nil {
+		return nil, fmt.Errorf("invalid BIRD greeting: %s", err)
+	}
+	if _, err := conn.Write([]byte("show protocols all\n")); err != nil {
+		return nil, err
+	}
+	lines, err := readBIRDReply(reader)
+	if err != nil {
+		return nil, err
+	}
+	c.sessions = parseBIRDProtocols(lines)
+	c.readAt = time.Now()
+	return c.sessions, nil
+}
+
+type birdLine struct {
+	code int
+	text string
+}
+
+// readBIRDReply reads the lines of a reply up to the line with the final reply code
+func readBIRDReply(reader *bufio.Reader) ([]birdLine, error) {
+	lines := make([]birdLine, 0)
+	code := 0
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\n")
+
+		// Continuation lines start with a space and keep the code of the previous line
+		if strings.HasPrefix(line, " ") {
+			lines = append(lines, birdLine{code: code, text: line[1:]})
+			continue
+		}
+		if len(line) < 5 || (line[4] != '-' && line[4] != ' ') {
+			return nil, fmt.Errorf("malformed reply line %q", line)
+		}
+		code, err = strconv.Atoi(line[:4])
+		if err != nil {
+			return nil, fmt.Errorf("malformed reply line %q", line)
+		}
+		lines = append(lines, birdLine{code: code, text: line[5:]})
+		if line[4] == ' ' {
+			if code >= 8000 {
+				return nil, fmt.Errorf("BIRD error %d: %s", code, strings.TrimSpace(line[5:]))
+			}
+			return lines, nil
+		}
+	}
+}
+
+// parseBIRDProtocols extracts the BGP sessions from the reply to "show protocols all"
+func parseBIRDProtocols(lines []birdLine) []BGPSession {
+	sessions := make([]BGPSession, 0)
+	var current *BGPSession
+	for _, line := range lines {
+		switch line.code {
+		case 1002:
+			// Name Proto Table State Since Info
+			current = nil
+			fields := strings.Fields(line.text)
+			if len(fields) >= 2 && fields[1] == "BGP" {
+				sessions = append(sessions, BGPSession{Protocol: fields[0]})
+				current = &sessions[len(sessions)-1]
+			}
+		case 1006:
+			if current == nil {
+				continue
+			}
+			key, value, found := strings.Cut(line.text, ":")
+			if !found {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			switch strings.TrimSpace(key) {
+			case "BGP state":
+				current.State = value
+			case "Neighbor address":
+				address, intFace, _ := strings.Cut(value, "%")
+				current.NeighborAddress = net.ParseIP(address)
+				current.Interface = intFace
+			case "Neighbor AS":
+				if asn, err := strconv.ParseUint(value, 10, 32); err == nil {
+					current.NeighborAS = uint32(asn)
+				}
+			}
+		}
+	}
+	return sessions
+}
+
+// sessionsOfInterfaces reads the BGP sessions from BIRD and maps them to the interfaces
+func sessionsOfInterfaces(client *BIRDClient, intFaces []net.Interface) map[string][]BGPSession {
+	sessions, err := client.Sessions()
+	if err != nil && !OutputJSON {
+		fmt.Printf(" -- Error reading BGP sessions from BIRD: %s\n", err)
+	}
+	return SessionsByInterface(sessions, intFaces)
+}
+
+// SessionsByInterface maps sessions to the interfaces they run over. Sessions without an
+// interface scope are mapped to the interface whose subnet contains the neighbor address, or
+// that has a route to it, as for tunnels with a /32 peer address.
+func SessionsByInterface(sessions []BGPSession, intFaces []net.Interface) map[string][]BGPSession {
+	routes, _ := readUnicastRoutes()
+	return sessionsByInterface(sessions, intFaces, routes)
+}
+
+func sessionsByInterface(sessions []BGPSession, intFaces []net.Interface, routes []unicastRoute) map[string][]BGPSession {
+	byInterface := make(map[string][]BGPSession)
+	for _, session := range sessions {
+		name := session.Interface
+		if name == "" && session.NeighborAddress != nil {
+			name = interfaceForNeighbor(session.NeighborAddress, intFaces, routes)
+		}
+		if name != "" {
+			byInterface[name] = append(byInterface[name], session)
+		}
+	}
+	return byInterface
+}
+
+func interfaceForNeighbor(neighbor net.IP, intFaces []net.Interface, routes []unicastRoute) string {
+	for _, intFace := range intFaces {
+		addresses, err := intFace.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, address := range addresses {
+			ipNet, ok := address.(*net.IPNet)
+			if ok && ipNet.Contains(neighbor) && !ipNet.IP.Equal(neighbor) {
+				return intFace.Name
+			}
+		}
+	}
+
+	// The most specific route wins, the default route tells nothing about the neighbor
+	name, longest := "", 0
+	for _, route := range routes {
+		if route.dst == nil || !route.dst.Contains(neighbor) {
+			continue
+		}
+		ones, _ := route.dst.Mask.Size()
+		if ones <= longest {
+			continue
+		}
+		for _, intFace := range intFaces {
+			if intFace.Index == route.ifIndex {
+				name, longest = intFace.Name, ones
+			}
+		}
+	}
+	return name
+}
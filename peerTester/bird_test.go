@@ -0,0 +1,184 @@
+package peerTester
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const birdProtocolsReply = "2002-Name       Proto      Table      State  Since         Info\n" +
+	"1002-device1    Device     ---        up     2024-05-01    \n" +
+	" \n" +
+	"1002-dn42_kioubit BGP      ---        up     2024-05-01    Established   \n" +
+	"1006-  BGP state:          Established\n" +
+	"     Neighbor address: fe80::ade0%dn42_kioubit\n" +
+	"     Neighbor AS:      4242423914\n" +
+	"     Local AS:         4242420000\n" +
+	" \n" +
+	"1002-dn42_tunnel BGP       ---        start  2024-05-01    Active        Socket: Connection refused\n" +
+	"1006-  BGP state:          Active\n" +
+	"     Neighbor address: 172.20.1.2\n" +
+	"     Neighbor AS:      4242421234\n" +
+	" \n" +
+	"0000 \n"
+
+// serveBIRD answers every command on a unix socket with the given reply, like the BIRD control socket
+func serveBIRD(t *testing.T, reply string) string {
+	path := filepath.Join(t.TempDir(), "bird.ctl")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				_, _ = conn.Write([]byte("0001 BIRD 2.0.12 ready.\n"))
+				reader := bufio.NewReader(conn)
+				for {
+					if _, err := reader.ReadString('\n'); err != nil {
+						return
+					}
+					_, _ = conn.Write([]byte(reply))
+				}
+			}()
+		}
+	}()
+	return path
+}
+
+func TestBIRDClientSessions(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   string
+		want    []BGPSession
+		wantErr bool
+	}{
+		{"protocols", birdProtocolsReply, []BGPSession{
+			{Protocol: "dn42_kioubit", State: "Established", NeighborAddress: net.ParseIP("fe80::ade0"), NeighborAS: 4242423914, Interface: "dn42_kioubit"},
+			{Protocol: "dn42_tunnel", State: "Active", NeighborAddress: net.ParseIP("172.20.1.2"), NeighborAS: 4242421234},
+		}, false},
+		{"no protocols", "0000 \n", []BGPSession{}, false},
+		{"error", "9001 Access denied\n", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewBIRDClient(serveBIRD(t, tt.reply))
+			got, err := client.Sessions()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Sessions() error = %v, want error %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sessions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadBIRDReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []birdLine
+		wantErr bool
+	}{
+		{"single line", "0001 BIRD 2.0.12 ready.\n", []birdLine{{1, "BIRD 2.0.12 ready."}}, false},
+		{"continuation", "1006-a\n b\n0000 \n", []birdLine{{1006, "a"}, {1006, "b"}, {0, ""}}, false},
+		{"error code", "8001 Reply too long\n", nil, true},
+		{"malformed", "hello\n", nil, true},
+		{"truncated", "1006-a\n", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readBIRDReply(bufio.NewReader(strings.NewReader(tt.input)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readBIRDReply() error = %v, want error %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readBIRDReply() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBIRDProtocols(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []birdLine
+		want  []BGPSession
+	}{
+		{"no protocols", []birdLine{{0, ""}}, []BGPSession{}},
+		{"other protocols are skipped", []birdLine{
+			{1002, "device1    Device     ---        up     2024-05-01"},
+			{1006, "  Channel ipv4"},
+			{1006, "    State:          UP"},
+		}, []BGPSession{}},
+		{"link-local neighbor", []birdLine{
+			{1002, "dn42_a     BGP        ---        up     2024-05-01    Established"},
+			{1006, "  BGP state:          Established"},
+			{1006, "    Neighbor address: fe80::1%dn42_a"},
+			{1006, "    Neighbor AS:      4242420001"},
+		}, []BGPSession{{Protocol: "dn42_a", State: "Established", NeighborAddress: net.ParseIP("fe80::1"), NeighborAS: 4242420001, Interface: "dn42_a"}}},
+		{"details after another protocol are not attached", []birdLine{
+			{1002, "dn42_a     BGP        ---        start  2024-05-01    Connect"},
+			{1006, "  BGP state:          Connect"},
+			{1002, "static1    Static     master4    up     2024-05-01"},
+			{1006, "  BGP state:          Established"},
+			{1006, "    Neighbor AS:      4242420002"},
+		}, []BGPSession{{Protocol: "dn42_a", State: "Connect"}}},
+		{"invalid values", []birdLine{
+			{1002, "dn42_b     BGP        ---        up     2024-05-01"},
+			{1006, "    Neighbor address: invalid"},
+			{1006, "    Neighbor AS:      AS4242420002"},
+			{1006, "    no separator"},
+		}, []BGPSession{{Protocol: "dn42_b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseBIRDProtocols(tt.lines); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseBIRDProtocols() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterfaceForNeighbor(t *testing.T) {
+	// Indexes that do not exist, so that only the routes are used
+	intFaces := []net.Interface{{Index: 100001, Name: "dn42_tunnel"}, {Index: 100002, Name: "dn42_other"}}
+	route := func(cidr string, ifIndex int) unicastRoute {
+		_, dst, _ := net.ParseCIDR(cidr)
+		return unicastRoute{dst: dst, ifIndex: ifIndex}
+	}
+	routes := []unicastRoute{
+		{ifIndex: 100002},
+		route("0.0.0.0/0", 100002),
+		route("172.20.0.0/14", 100002),
+		route("172.20.1.2/32", 100001),
+		route("fd00::/8", 100002),
+	}
+	tests := []struct {
+		neighbor string
+		want     string
+	}{
+		{"172.20.1.2", "dn42_tunnel"},
+		{"172.20.1.3", "dn42_other"},
+		{"fd42::1", "dn42_other"},
+		{"10.0.0.1", ""},
+		{"2001:db8::1", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.neighbor, func(t *testing.T) {
+			if got := interfaceForNeighbor(net.ParseIP(tt.neighbor), intFaces, routes); got != tt.want {
+				t.Errorf("interfaceForNeighbor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
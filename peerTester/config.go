@@ -0,0 +1,240 @@
+package peerTester
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"time"
+)
+
+// Config is the peer configuration file
+type Config struct {
+	// Dst4 and Dst6 are used when the destination addresses are not given on the command line
+	Dst4  string       `json:"dst4"`
+	Dst6  string       `json:"dst6"`
+	Peers []PeerConfig `json:"peers"`
+}
+
+// PeerConfig configures the test of the interfaces matching Interface
+type PeerConfig struct {
+	// Interface is an interface name or a glob pattern such as "dn42_*"
+	Interface     string   `json:"interface"`
+	Name          string   `json:"name"`
+	ASN           uint32   `json:"asn"`
+	Families      []string `json:"families"`
+	ExpectedHops  int      `json:"expected_hops"`
+	ProbeCount    int      `json:"probe_count"`
+	ProbeInterval Duration `json:"probe_interval"`
+	Timeout       Duration `json:"timeout"`
+	Src4          []string `json:"src4"`
+	Src6          []string `json:"src6"`
+	Dst4          string   `json:"dst4"`
+	Dst6          string   `json:"dst6"`
+	Neighbor4     string   `json:"neighbor4"`
+	Neighbor6     string   `json:"neighbor6"`
+	PeerMAC       string   `json:"peer_mac"`
+	Traceroute    bool     `json:"traceroute"`
+	PathMTU       bool     `json:"path_mtu"`
+	DSCP          int      `json:"dscp"`
+	ECN           int      `json:"ecn"`
+
+	options TestOptions
+}
+
+// Duration is a time.Duration encoded as a string such as "1.5s" in JSON
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"2s\": %s", err)
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// LoadConfig reads and validates a JSON peer configuration file
+func LoadConfig(fileName string) (*Config, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %s", fileName, err)
+	}
+	for i := range config.Peers {
+		peer := &config.Peers[i]
+		if peer.Interface == "" {
+			return nil, fmt.Errorf("peer %d: missing interface", i+1)
+		}
+		if _, err := path.Match(peer.Interface, ""); err != nil {
+			return nil, fmt.Errorf("peer %s: invalid interface pattern: %s", peer.Interface, err)
+		}
+		peer.options, err = peer.testOptions()
+		if err != nil {
+			return nil, fmt.Errorf("peer %s: %s", peer.Interface, err)
+		}
+	}
+	return config, nil
+}
+
+func (p *PeerConfig) testOptions() (TestOptions, error) {
+	opts := TestOptions{
+		ProbeCount:    p.ProbeCount,
+		ProbeInterval: time.Duration(p.ProbeInterval),
+		Timeout:       time.Duration(p.Timeout),
+		ExpectedHops:  p.ExpectedHops,
+		Traceroute:    p.Traceroute,
+		PathMTU:       p.PathMTU,
+		DSCP:          p.DSCP,
+		ECN:           p.ECN,
+	}
+	if err := ValidateMarking(p.DSCP, p.ECN); err != nil {
+		return opts, err
+	}
+	if p.Name != "" || p.ASN != 0 {
+		opts.Peer = &PeerInfo{Name: p.Name, ASN: p.ASN}
+	}
+
+	for _, family := range p.Families {
+		switch family {
+		case "ipv4", "4":
+			opts.Families |= FamilyIPv4
+		case "ipv6", "6":
+			opts.Families |= FamilyIPv6
+		default:
+			return opts, fmt.Errorf("unknown address family %s", family)
+		}
+	}
+	if len(p.Families) != 0 && opts.Families == 0 {
+		return opts, fmt.Errorf("no address family enabled")
+	}
+
+	var err error
+	if opts.Sources4, err = parseConfigIPs(p.Src4, true); err != nil {
+		return opts, err
+	}
+	if opts.Sources6, err = parseConfigIPs(p.Src6, false); err != nil {
+		return opts, err
+	}
+	for _, ip := range []struct {
+		value  string
+		target *net.IP
+		isV4   bool
+	}{
+		{p.Dst4, &opts.Destination4, true},
+		{p.Dst6, &opts.Destination6, false},
+		{p.Neighbor4, &opts.Neighbor4, true},
+		{p.Neighbor6, &opts.Neighbor6, false},
+	} {
+		if ip.value == "" {
+			continue
+		}
+		parsed, err := parseConfigIPs([]string{ip.value}, ip.isV4)
+		if err != nil {
+			return opts, err
+		}
+		*ip.target = parsed[0]
+	}
+	if p.PeerMAC != "" {
+		if opts.PeerMAC, err = net.ParseMAC(p.PeerMAC); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+func parseConfigIPs(values []string, isV4 bool) ([]net.IP, error) {
+	ips := make([]net.IP, 0, len(values))
+	for _, value := range values {
+		ip := net.ParseIP(value)
+		if ip == nil || (ip.To4() != nil) != isV4 {
+			if isV4 {
+				return nil, fmt.Errorf("invalid IPv4 address %s", value)
+			}
+			return nil, fmt.Errorf("invalid IPv6 address %s", value)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+// Match returns the first peer entry matching the interface name. Entries with the exact name
+// take precedence over patterns.
+func (c *Config) Match(name string) *PeerConfig {
+	for i := range c.Peers {
+		if c.Peers[i].Interface == name {
+			return &c.Peers[i]
+		}
+	}
+	for i := range c.Peers {
+		if matched, _ := path.Match(c.Peers[i].Interface, name); matched {
+			return &c.Peers[i]
+		}
+	}
+	return nil
+}
+
+// Interfaces returns the interfaces matching any peer entry
+func (c *Config) Interfaces(intFaces []net.Interface) []net.Interface {
+	matching := make([]net.Interface, 0)
+	for _, intFace := range intFaces {
+		if c.Match(intFace.Name) != nil {
+			matching = append(matching, intFace)
+		}
+	}
+	return matching
+}
+
+// Apply returns opts with per-interface overrides for every interface matching a peer entry.
+// Existing overrides in opts take precedence over the configuration file.
+func (c *Config) Apply(opts TestOptions, intFaces []net.Interface) TestOptions {
+	overrides := make(map[string]TestOptions, len(intFaces))
+	for _, intFace := range intFaces {
+		peer := c.Match(intFace.Name)
+		if peer == nil {
+			continue
+		}
+		overrides[intFace.Name] = peer.options
+	}
+	for name, override := range opts.Overrides {
+		overrides[name] = overrides[name].Merge(override)
+	}
+	opts.Overrides = overrides
+	return opts
+}
+
+// Sources returns the source addresses set by peer entries
+func (c *Config) Sources() []net.IP {
+	sources := make([]net.IP, 0)
+	for _, peer := range c.Peers {
+		sources = append(sources, peer.options.Sources4...)
+		sources = append(sources, peer.options.Sources6...)
+	}
+	return sources
+}
+
+// Destinations returns the destination addresses set by peer entries
+func (c *Config) Destinations() []net.IP {
+	destinations := make([]net.IP, 0)
+	for _, peer := range c.Peers {
+		if peer.options.Destination4 != nil {
+			destinations = append(destinations, peer.options.Destination4)
+		}
+		if peer.options.Destination6 != nil {
+			destinations = append(destinations, peer.options.Destination6)
+		}
+	}
+	return destinations
+}
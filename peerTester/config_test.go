@@ -0,0 +1,86 @@
+package peerTester
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfigMatch(t *testing.T) {
+	config := &Config{Peers: []PeerConfig{
+		{Interface: "dn42_*", Name: "pattern"},
+		{Interface: "dn42_kioubit", Name: "exact"},
+		{Interface: "wg?", Name: "single character"},
+		{Interface: "dn42_*", Name: "second pattern"},
+	}}
+	tests := []struct {
+		name string
+		// want is the name of the matching peer entry, empty if none matches
+		want string
+	}{
+		{"dn42_kioubit", "exact"},
+		{"dn42_other", "pattern"},
+		{"wg0", "single character"},
+		{"wg10", ""},
+		{"eth0", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			if peer := config.Match(tt.name); peer != nil {
+				got = peer.Name
+			}
+			if got != tt.want {
+				t.Errorf("Match() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    TestOptions
+		wantErr bool
+	}{
+		{"options", `{"peers": [{"interface": "dn42_*", "name": "alice", "asn": 4242420001, "families": ["ipv6"],
+			"probe_count": 5, "timeout": "1.5s", "src6": ["fd00::1"], "dst4": "172.20.0.1", "expected_hops": 2}]}`,
+			TestOptions{
+				ProbeCount:   5,
+				Timeout:      1500 * time.Millisecond,
+				Families:     FamilyIPv6,
+				Sources4:     []net.IP{},
+				Sources6:     []net.IP{net.ParseIP("fd00::1")},
+				Destination4: net.ParseIP("172.20.0.1"),
+				Peer:         &PeerInfo{Name: "alice", ASN: 4242420001},
+				ExpectedHops: 2,
+			}, false},
+		{"missing interface", `{"peers": [{"name": "alice"}]}`, TestOptions{}, true},
+		{"invalid pattern", `{"peers": [{"interface": "dn42_["}]}`, TestOptions{}, true},
+		{"unknown family", `{"peers": [{"interface": "wg0", "families": ["ipx"]}]}`, TestOptions{}, true},
+		{"source of the wrong family", `{"peers": [{"interface": "wg0", "src4": ["fd00::1"]}]}`, TestOptions{}, true},
+		{"invalid duration", `{"peers": [{"interface": "wg0", "timeout": 2}]}`, TestOptions{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "peers.json")
+			if err := os.WriteFile(fileName, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			config, err := LoadConfig(fileName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := config.Peers[0].options; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadConfig() options = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package peerTester
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+)
+
+// configuredFamilies returns the address families the interface has an address or a route for
+func configuredFamilies(intFace *net.Interface) Family {
+	var families Family
+	if addresses, err := intFace.Addrs(); err == nil {
+		families = addressFamilies(addresses)
+	}
+	if families == FamilyAll {
+		return families
+	}
+	return families | routedFamilies(intFace.Index)
+}
+
+// addressFamilies returns the address families of the addresses. Link-local addresses are
+// ignored, as the kernel assigns an fe80::/64 address to almost every interface.
+func addressFamilies(addresses []net.Addr) Family {
+	var families Family
+	for _, address := range addresses {
+		ipNet, ok := address.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			families |= FamilyIPv4
+		} else {
+			families |= FamilyIPv6
+		}
+	}
+	return families
+}
+
+// unicastRoute is a unicast route of the kernel routing tables outside the local table
+type unicastRoute struct {
+	family  uint8
+	dst     *net.IPNet
+	ifIndex int
+}
+
+func readUnicastRoutes() ([]unicastRoute, error) {
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETROUTE, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := make([]unicastRoute, 0)
+	for _, m := range messages {
+		if m.Header.Type != syscall.RTM_NEWROUTE || len(m.Data) < syscall.SizeofRtMsg {
+			continue
+		}
+		family, dstLength, table, routeType := m.Data[0], int(m.Data[1]), m.Data[4], m.Data[7]
+		if table == syscall.RT_TABLE_LOCAL || routeType != syscall.RTN_UNICAST {
+			continue
+		}
+		attributes := m.Data[syscall.SizeofRtMsg:]
+		oif, ok := findAttribute(attributes, syscall.RTA_OIF)
+		if !ok || len(oif) < 4 {
+			continue
+		}
+		route := unicastRoute{family: family, ifIndex: int(int32(binary.NativeEndian.Uint32(oif)))}
+		if dst, ok := findAttribute(attributes, syscall.RTA_DST); ok && (len(dst) == net.IPv4len || len(dst) == net.IPv6len) {
+			route.dst = &net.IPNet{
+				IP:   net.IP(append([]byte(nil), dst...)),
+				Mask: net.CIDRMask(dstLength, len(dst)*8),
+			}
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// routedFamilies returns the address families with a unicast route through the interface.
+// Routes the kernel adds to every interface, such as fe80::/64, are ignored.
+func routedFamilies(ifIndex int) Family {
+	routes, err := readUnicastRoutes()
+	if err != nil {
+		return 0
+	}
+
+	var families Family
+	for _, route := range routes {
+		if route.ifIndex != ifIndex {
+			continue
+		}
+		switch route.family {
+		case syscall.AF_INET:
+			families |= FamilyIPv4
+		case syscall.AF_INET6:
+			if route.dst != nil && route.dst.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			families |= FamilyIPv6
+		}
+	}
+	return families
+}
@@ -0,0 +1,38 @@
+package peerTester
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAddressFamilies(t *testing.T) {
+	tests := []struct {
+		name      string
+		addresses []string
+		want      Family
+	}{
+		{"none", nil, 0},
+		{"ipv4", []string{"172.20.0.1/31"}, FamilyIPv4},
+		{"ipv6", []string{"fd42::1/127"}, FamilyIPv6},
+		{"both", []string{"172.20.0.1/32", "fd42::1/128"}, FamilyAll},
+		{"only link-local ipv6", []string{"fe80::1/64"}, 0},
+		{"ipv4 and link-local ipv6", []string{"172.20.0.1/31", "fe80::1/64"}, FamilyIPv4},
+		{"only link-local ipv4", []string{"169.254.0.1/16"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addresses := make([]net.Addr, 0, len(tt.addresses))
+			for _, cidr := range tt.addresses {
+				ip, ipNet, err := net.ParseCIDR(cidr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ipNet.IP = ip
+				addresses = append(addresses, ipNet)
+			}
+			if got := addressFamilies(addresses); got != tt.want {
+				t.Errorf("addressFamilies() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,7 +2,6 @@ package peerTester
 
 import (
 	"fmt"
-	"math"
 	"net"
 	"strconv"
 	"sync"
@@ -11,66 +10,291 @@ import (
 )
 
 type ListenResult struct {
-	Status      testResult
-	ErrorText   string
-	Latency     int
+	Status    testResult
+	ErrorText string
+	// LatencyUs is the mean round trip time in microseconds, or -1 if no reply was received
+	LatencyUs   int64
 	PacketsLost int
+	Stats       *LatencyStats
+	// TimestampSource tells whether the RTTs were measured with kernel or userspace timestamps
+	TimestampSource string
+	// TTL is the TTL or hop limit of the last received probe, or -1 if unknown
+	TTL int32
+	// Hops is the number of routers the probes passed, inferred from the TTL, or -1 if unknown
+	Hops int
+	// ICMPError is the ICMP error received instead of the probes, if any
+	ICMPError *ICMPError
+	// ICMPUnavailable is set if the source address is not assigned to this host, so ICMP errors
+	// caused by the probes cannot be received
+	ICMPUnavailable bool
+	// Trace holds the path of a traceroute run after the test failed, if enabled
+	Trace []Hop
+	// NAT describes how the probes were rewritten, if they were
+	NAT *NATFinding
+	// PathMTU is the result of the path MTU test, if enabled
+	PathMTU *PathMTU
+	// QoS compares the DSCP and ECN bits of the last received probe to the sent ones
+	QoS         *QoS
 	receiveTime timeInfo
+	sourceIndex uint8
 	isV4        bool
 	remoteIP    net.IP
-	ttlValue    int32
+	remotePort  int
+	// tampered is set if the HMAC of the probe did not match
+	tampered bool
+	// trafficClass is the received IPv4 TOS or IPv6 traffic class, or -1 if unknown
+	trafficClass int
+	// source and destination are the addresses the probes were sent with
+	source      net.IP
+	destination net.IP
+	probes      []probeTiming
+	icmp        *icmpMessage
+}
+
+// newListenResult returns a result without any received probe
+func newListenResult(status testResult, errorText string) *ListenResult {
+	return &ListenResult{Status: status, ErrorText: errorText, LatencyUs: -1, TTL: -1, Hops: -1}
 }
 
 type IntFaceResult struct {
+	// V4 and V6 hold the results of the first source address of each family
 	V4 *ListenResult
 	V6 *ListenResult
+	// BySource holds the results of every source address if more than one was tested
+	BySource map[string]*ListenResult
+	// Peer is the peer configured for the interface, if any
+	Peer *PeerInfo
+	// BGP holds the BIRD BGP sessions running over the interface
+	BGP   []BGPSession
+	index int
+	alias string
+}
+
+// probeTiming holds the send and receive time of a probe. received is zero for lost probes.
+type probeTiming struct {
+	id       uint8
+	sent     time.Time
+	received time.Time
+}
+
+func (r *IntFaceResult) healthy() bool {
+	for _, result := range r.BySource {
+		if result.Status.Failed() {
+			return false
+		}
+	}
+	return !r.V4.Status.Failed() && !r.V6.Status.Failed()
+}
+
+func (r *IntFaceResult) sameStatus(other *IntFaceResult) bool {
+	return r.V4.Status == other.V4.Status && r.V6.Status == other.V6.Status
 }
 
-func PerformTests(intFaces []net.Interface, dstIp net.IP, dstIp6 net.IP) (resultMap map[string]*IntFaceResult) {
+// Tester owns the UDP listener that receives the probes. It can be shared by many
+// concurrent test runs, which allows keeping the listener alive between runs.
+type Tester struct {
+	opts        TesterOptions
+	dispatcher  *resultDispatcher
+	stopChannel chan bool
+	stopWG      sync.WaitGroup
+
+	listenMutex sync.Mutex
+	listening   map[string]bool
+	// warnedSources holds the source addresses that were checked by warnNonLocalSources
+	warnedSources sync.Map
+}
+
+// TesterOptions configures the listener of a Tester
+type TesterOptions struct {
+	// Port is the UDP destination port of the probes and the port the listener binds to
+	Port int
+	// ListenAddresses are the addresses the listener binds to. Usually these are the
+	// destination addresses of the probes. The listener binds to all addresses if empty.
+	ListenAddresses []net.IP
+}
+
+func DefaultTesterOptions() TesterOptions {
+	return TesterOptions{
+		Port: 5000,
+	}
+}
+
+func NewTester(opts TesterOptions) (*Tester, error) {
 	setHighPriority()
-	resultMap = make(map[string]*IntFaceResult)
 	newHmacKey()
 
-	var listenResultChannel = make(chan *ListenResult, 4)
-	var stopChannel = make(chan bool)
-	var stopWG sync.WaitGroup
+	if opts.Port <= 0 {
+		opts.Port = DefaultTesterOptions().Port
+	}
 
-	var readyToListen sync.WaitGroup
-	readyToListen.Add(1)
-	stopWG.Add(1)
-	go listenIntoChannel(listenResultChannel, stopChannel, &stopWG, &readyToListen)
-	readyToListen.Wait()
+	t := &Tester{
+		opts:        opts,
+		dispatcher:  newResultDispatcher(),
+		stopChannel: make(chan bool),
+		listening:   make(map[string]bool),
+	}
 
-	var interFaceCount = len(intFaces)
-	if interFaceCount > math.MaxInt16 {
-		if !OutputJSON {
-			fmt.Println("Warning: Too many interfaces. Truncating list.")
+	listenAddresses := opts.ListenAddresses
+	if len(listenAddresses) == 0 {
+		listenAddresses = []net.IP{nil}
+	}
+	if err := t.Listen(listenAddresses); err != nil {
+		t.Close()
+		return nil, err
+	}
+	if err := t.listenICMP(); err != nil {
+		t.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// listenICMP starts receiving the ICMP and ICMPv6 errors caused by probes
+func (t *Tester) listenICMP() error {
+	for _, isV4 := range []bool{true, false} {
+		conn, err := openICMPListener(isV4)
+		if err != nil {
+			return err
 		}
-		intFaces = intFaces[:math.MaxInt16]
+		t.stopWG.Add(1)
+		go listenICMPIntoChannel(conn, isV4, t.opts.Port, t.dispatcher, t.stopChannel, &t.stopWG)
 	}
+	return nil
+}
 
-	for counter, intFace := range intFaces {
-		r := testInterface(intFace, listenResultChannel, dstIp, dstIp6, counter)
-		if !OutputJSON {
-			fmt.Printf("[%-10s] V4: %-7s (%-3dms - Lost %d pkts) V6: %-7s (%-3dms - Lost %d pkts)\n", intFace.Name, r.V4.ErrorText, r.V4.Latency, r.V4.PacketsLost, r.V6.ErrorText, r.V6.Latency, r.V6.PacketsLost)
+// Listen starts listening on addresses that are not covered by the listener yet. A nil address
+// listens on all addresses.
+func (t *Tester) Listen(addresses []net.IP) error {
+	t.listenMutex.Lock()
+	defer t.listenMutex.Unlock()
+	for _, address := range addresses {
+		if t.listening[""] {
+			// Already listening on all addresses
+			return nil
+		}
+		key := ""
+		if address != nil {
+			key = address.String()
+		}
+		if t.listening[key] {
+			continue
 		}
-		resultMap[intFace.Name] = r
 
-		if counter != interFaceCount {
-			time.Sleep(10 * time.Millisecond)
+		conn, err := openListener(address, t.opts.Port)
+		if err != nil {
+			return err
 		}
+		t.listening[key] = true
+		if !OutputJSON {
+			fmt.Println("Listening on udp", conn.LocalAddr())
+		}
+		t.stopWG.Add(1)
+		go listenIntoChannel(conn, t.dispatcher, t.stopChannel, &t.stopWG)
+	}
+	return nil
+}
+
+// Listening reports whether the listener receives probes sent to the address
+func (t *Tester) Listening(address net.IP) bool {
+	t.listenMutex.Lock()
+	defer t.listenMutex.Unlock()
+	return t.listening[""] || t.listening[address.String()]
+}
+
+// Close stops the listener
+func (t *Tester) Close() {
+	close(t.stopChannel) // Request listener stop
+
+	wgWaitTimout(&t.stopWG, 2*time.Second)
+}
+
+func (t *Tester) PerformTests(intFaces []net.Interface, dstIp net.IP, dstIp6 net.IP, opts TestOptions) (resultMap map[string]*IntFaceResult) {
+	resultMap = make(map[string]*IntFaceResult)
+	metricRuns.Add(1)
+	if opts.BIRD != nil {
+		opts.bgp = sessionsOfInterfaces(opts.BIRD, intFaces)
 	}
 
-	close(stopChannel) // Request listener stop
+	var jobs = make(chan net.Interface)
+	var resultMutex sync.Mutex
+	var workerWG sync.WaitGroup
+	for w := 0; w < max(Concurrency, 1); w++ {
+		workerWG.Add(1)
+		go func() {
+			defer workerWG.Done()
+			for intFace := range jobs {
+				r := t.TestInterface(intFace, dstIp, dstIp6, opts)
 
-	wgWaitTimout(&stopWG, 2*time.Second)
+				resultMutex.Lock()
+				resultMap[intFace.Name] = r
+				resultMutex.Unlock()
+			}
+		}()
+	}
+	for _, intFace := range intFaces {
+		jobs <- intFace
+	}
+	close(jobs)
+	workerWG.Wait()
 	return
 }
 
-func testInterface(intFace net.Interface, listenResultChannel chan *ListenResult, dstIp net.IP, dstIp6 net.IP, counter int) *IntFaceResult {
-	fr := &IntFaceResult{
-		V4: &ListenResult{Status: Timeout, ErrorText: "timeout", Latency: -1},
-		V6: &ListenResult{Status: Timeout, ErrorText: "timeout", Latency: -1},
+// TestInterface tests a single interface. It is safe to call concurrently.
+func (t *Tester) TestInterface(intFace net.Interface, dstIp net.IP, dstIp6 net.IP, opts TestOptions) *IntFaceResult {
+	opts = opts.ForInterface(intFace.Name).normalize()
+	opts.port = t.opts.Port
+	t.warnNonLocalSources(opts.sources())
+	metricTests.Add(1)
+	counter, listenResultChannel := t.dispatcher.register(len(opts.sources()) * opts.ProbeCount)
+	r := testInterface(intFace, listenResultChannel, dstIp, dstIp6, counter, opts)
+	t.dispatcher.unregister(counter)
+
+	if opts.Traceroute {
+		t.traceFailures(intFace, r, dstIp, dstIp6, opts)
+	}
+	if opts.PathMTU {
+		t.measurePathMTUs(intFace, r, dstIp, dstIp6, opts)
+	}
+	return r
+}
+
+func testInterface(intFace net.Interface, listenResultChannel chan *ListenResult, dstIp net.IP, dstIp6 net.IP, counter uint16, opts TestOptions) *IntFaceResult {
+	if opts.Destination4 != nil {
+		dstIp = opts.Destination4
+	}
+	if opts.Destination6 != nil {
+		dstIp6 = opts.Destination6
+	}
+
+	// Families without a destination address or without any address or route on the interface are not tested
+	var notConfigured Family
+	if dstIp == nil {
+		notConfigured |= FamilyIPv4
+	}
+	if dstIp6 == nil {
+		notConfigured |= FamilyIPv6
+	}
+	if !opts.SkipFamilyDetection {
+		notConfigured |= FamilyAll &^ configuredFamilies(&intFace)
+	}
+	notConfigured &= opts.Families
+	opts.Families &^= notConfigured
+
+	sources := opts.sources()
+	results := make([]*ListenResult, len(sources))
+	for i := range results {
+		results[i] = newListenResult(Timeout, "timeout")
+	}
+	fr := &IntFaceResult{Peer: opts.Peer, index: intFace.Index, alias: interfaceAlias(&intFace)}
+	fr.V4, fr.V6 = familyResults(results, opts, notConfigured)
+	if opts.bgp != nil {
+		fr.BGP = opts.bgp[intFace.Name]
+	} else if opts.BIRD != nil {
+		fr.BGP = sessionsOfInterfaces(opts.BIRD, []net.Interface{intFace})[intFace.Name]
+	}
+
+	if len(sources) == 0 {
+		return fr
 	}
 
 	var doneWg sync.WaitGroup
@@ -84,8 +308,9 @@ func testInterface(intFace net.Interface, listenResultChannel chan *ListenResult
 		defer doneWg.Done()
 
 		var err error
-		sendMeasurements, err = sendOnInterface(intFace, SourceIPv4, SourceIPv6, dstIp, dstIp6, counter)
+		sendMeasurements, err = sendOnInterface(intFace, sources, dstIp, dstIp6, counter, opts)
 		if err != nil {
+			metricSendErrors.Add(1)
 			if !OutputJSON {
 				fmt.Printf(" -- Error sending on interface %s: %s\n", intFace.Name, err)
 			}
@@ -93,11 +318,20 @@ func testInterface(intFace net.Interface, listenResultChannel chan *ListenResult
 		}
 	}()
 
-	timeoutChan := time.After(2 * time.Second)
-	for i := 0; i < 4; i++ {
+	// The timeout applies after the last probe has been sent
+	expectedPackets := len(sources) * opts.ProbeCount
+	sendDuration := time.Duration(expectedPackets) * opts.ProbeInterval
+	timeoutChan := time.After(opts.Timeout + sendDuration)
+	// Every probe is answered either by the probe itself or by an ICMP error
+	var icmpResults = make([]*ListenResult, 0)
+	for len(receiveResults)+len(icmpResults) < expectedPackets {
 		timedOut := false
 		select {
 		case result := <-listenResultChannel:
+			if result.icmp != nil {
+				icmpResults = append(icmpResults, result)
+				continue
+			}
 			receiveResults = append(receiveResults, result)
 		case <-timeoutChan:
 			timedOut = true
@@ -115,73 +349,176 @@ func testInterface(intFace net.Interface, listenResultChannel chan *ListenResult
 		return fr
 	}
 
-	v4Latencies := make([]int, 0)
-	v6Latencies := make([]int, 0)
+	latencies := make([][]latencySample, len(sources))
+	received := make(map[[2]uint8]time.Time)
+	peer := newPeerAddresses(&intFace, opts, fr.BGP)
 
 	for _, result := range receiveResults {
-		if result.isV4 {
-			if result.remoteIP.Equal(SourceIPv4) {
-				if result.ttlValue != 63 && result.ttlValue != -1 {
-					result.Status = UnexpectedTTL
-					result.ErrorText = "TTL value of " + strconv.FormatInt(int64(result.ttlValue), 10)
-				} else {
-					result.Status = OK
-					result.ErrorText = "OK"
-				}
-			} else {
-				result.ErrorText = "Invalid source IP: " + result.remoteIP.String()
-				result.Status = InvalidIP
+		sourceIndex := int(result.sourceIndex)
+		if sourceIndex >= len(sources) || result.isV4 != (sources[sourceIndex].To4() != nil) {
+			continue
+		}
+
+		var sent *timeInfo
+		for i, sendMeasurement := range sendMeasurements {
+			if result.receiveTime.id == sendMeasurement.id && result.sourceIndex == sendMeasurement.sourceIndex {
+				sent = &sendMeasurements[i]
+				break
 			}
-			fr.V4 = result
-		} else {
-			if result.remoteIP.Equal(SourceIPv6) {
-				if result.ttlValue != 63 && result.ttlValue != -1 {
-					result.Status = UnexpectedTTL
-					result.ErrorText = "TTL value of " + strconv.FormatInt(int64(result.ttlValue), 10)
-				} else {
-					result.Status = OK
-					result.ErrorText = "OK"
-				}
-			} else {
-				result.ErrorText = "Invalid source IP: " + result.remoteIP.String()
-				result.Status = InvalidIP
+		}
+		if result.tampered && !acceptTampered(result, sent, sources[sourceIndex], received) {
+			continue
+		}
+		expectedPort := 0
+		if sent != nil {
+			// Duplicated replies are only counted once
+			if _, duplicate := received[[2]uint8{sent.sourceIndex, sent.id}]; duplicate {
+				continue
 			}
-			fr.V6 = result
+			expectedPort = sent.srcPort
+		}
+		evaluateResult(result, sources[sourceIndex], expectedPort, peer, opts.expectedTTL())
+		if result.trafficClass >= 0 {
+			result.QoS = compareQoS(opts.trafficClass(), uint8(result.trafficClass))
+		}
+		// A tampered probe is not hidden by intact probes received later
+		if results[sourceIndex].Status != PayloadTampered {
+			results[sourceIndex] = result
 		}
+
 		// Latency recording
+		if sent != nil {
+			received[[2]uint8{sent.sourceIndex, sent.id}] = result.receiveTime.time
+			latencies[sourceIndex] = append(latencies[sourceIndex], latencySample{
+				id:     sent.id,
+				rtt:    result.receiveTime.time.Sub(sent.time),
+				kernel: sent.kernel && result.receiveTime.kernel,
+			})
+		}
+	}
+
+	// Probes that never arrived may have been rejected on the way
+	for _, result := range icmpResults {
+		status, ok := result.icmp.status(result.isV4)
+		if !ok {
+			continue
+		}
+		for i, source := range sources {
+			if !source.Equal(result.icmp.source) || len(latencies[i]) != 0 || results[i].Status != Timeout {
+				continue
+			}
+			results[i].Status = status
+			results[i].ICMPError = result.icmp.export()
+			if status == PeerNoRoute {
+				results[i].ErrorText = "No route at " + result.icmp.from.String()
+			} else {
+				results[i].ErrorText = "Filtered by " + result.icmp.from.String()
+			}
+		}
+	}
+
+	for i, result := range results {
+		result.source = sources[i]
+		result.ICMPUnavailable = !isLocalAddress(sources[i])
+		result.destination = dstIp6
+		if sources[i].To4() != nil {
+			result.destination = dstIp
+		}
 		for _, sendMeasurement := range sendMeasurements {
-			if result.receiveTime.id == sendMeasurement.id {
-				// Found corresponding measurement
-				if result.isV4 {
-					v4Latencies = append(v4Latencies, int(result.receiveTime.time.Sub(sendMeasurement.time).Milliseconds()))
-				} else {
-					v6Latencies = append(v6Latencies, int(result.receiveTime.time.Sub(sendMeasurement.time).Milliseconds()))
-				}
-				break
+			if int(sendMeasurement.sourceIndex) != i {
+				continue
 			}
+			result.probes = append(result.probes, probeTiming{
+				id:       sendMeasurement.id,
+				sent:     sendMeasurement.time,
+				received: received[[2]uint8{sendMeasurement.sourceIndex, sendMeasurement.id}],
+			})
 		}
+		if len(latencies[i]) != 0 {
+			result.Stats = computeLatencyStats(latencies[i])
+			result.LatencyUs = int64(result.Stats.Mean)
+			result.TimestampSource = timestampSource(latencies[i])
+		}
+		result.PacketsLost = opts.ProbeCount - len(latencies[i])
 	}
 
-	if len(v4Latencies) != 0 {
-		var sum = 0
-		for i := 0; i < len(v4Latencies); i++ {
-			sum += max(v4Latencies[i], 0)
+	fr.V4, fr.V6 = familyResults(results, opts, notConfigured)
+	if len(opts.sources4()) > 1 || len(opts.sources6()) > 1 {
+		fr.BySource = make(map[string]*ListenResult, len(sources))
+		for i, source := range sources {
+			fr.BySource[source.String()] = results[i]
 		}
-		fr.V4.Latency = sum / len(v4Latencies)
 	}
 
-	if len(v6Latencies) != 0 {
-		var sum = 0
-		for i := 0; i < len(v6Latencies); i++ {
-			sum += max(v6Latencies[i], 0)
+	return fr
+}
+
+// familyResults returns the results of the first source address of each address family
+func familyResults(results []*ListenResult, opts TestOptions, notConfigured Family) (v4 *ListenResult, v6 *ListenResult) {
+	untested := func(family Family) *ListenResult {
+		if notConfigured&family != 0 {
+			return newListenResult(NotConfigured, "not configured")
 		}
-		fr.V6.Latency = sum / len(v6Latencies)
+		return newListenResult(Disabled, "disabled")
+	}
+	v4, v6 = untested(FamilyIPv4), untested(FamilyIPv6)
+	count4 := len(opts.sources4())
+	if count4 > 0 {
+		v4 = results[0]
+	}
+	if len(opts.sources6()) > 0 {
+		v6 = results[count4]
 	}
+	return v4, v6
+}
 
-	fr.V6.PacketsLost = int(packetCount) - len(v6Latencies)
-	fr.V4.PacketsLost = int(packetCount) - len(v4Latencies)
+// evaluateResult sets the status of a received probe that was sent with the given source address
+// and port. Rewrites of the source address are classified against the peer's addresses.
+func evaluateResult(result *ListenResult, source net.IP, sourcePort int, peer *peerAddresses, expectedTTL int32) {
+	if result.TTL != -1 {
+		result.Hops = probeTTL - int(result.TTL)
+	}
+	finding := &NATFinding{ObservedAddress: result.remoteIP, ObservedPort: result.remotePort, ExpectedPort: sourcePort}
+	switch {
+	case result.tampered:
+		finding.Kind = NATPayload
+		result.Status = PayloadTampered
+	case !result.remoteIP.Equal(source):
+		finding.Kind = classifyAddressNAT(result.remoteIP, peer)
+		result.Status = InvalidIP
+	case sourcePort != 0 && result.remotePort != sourcePort:
+		finding.Kind = NATPortOnly
+		result.Status = PortRewritten
+	default:
+		finding = nil
+	}
+	if finding != nil {
+		result.NAT = finding
+		result.ErrorText = finding.String()
+		return
+	}
 
-	return fr
+	if result.TTL != expectedTTL && result.TTL != -1 {
+		result.Status = UnexpectedTTL
+		result.ErrorText = "TTL value of " + strconv.FormatInt(int64(result.TTL), 10)
+	} else {
+		result.Status = OK
+		result.ErrorText = "OK"
+	}
+}
+
+func formatLatency(latencyUs int64) string {
+	if latencyUs < 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(float64(latencyUs)/1000, 'f', 3, 64) + "ms"
+}
+
+func formatHops(hops int) string {
+	if hops < 0 {
+		return "-"
+	}
+	return strconv.Itoa(hops)
 }
 
 func setHighPriority() {
@@ -0,0 +1,328 @@
+package peerTester
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Format is an output format of the results of a test run
+type Format string
+
+const (
+	FormatText     Format = "text"
+	FormatJSON     Format = "json"
+	FormatCSV      Format = "csv"
+	FormatMarkdown Format = "markdown"
+	FormatJUnit    Format = "junit"
+	FormatTAP      Format = "tap"
+)
+
+// Formats lists the supported output formats
+var Formats = []Format{FormatText, FormatJSON, FormatCSV, FormatMarkdown, FormatJUnit, FormatTAP}
+
+// ParseFormat returns the format with the given name
+func ParseFormat(name string) (Format, error) {
+	if slices.Contains(Formats, Format(name)) {
+		return Format(name), nil
+	}
+	names := make([]string, len(Formats))
+	for i, format := range Formats {
+		names[i] = string(format)
+	}
+	return "", fmt.Errorf("unknown output format %s, must be one of %s", name, strings.Join(names, ", "))
+}
+
+// WriteResults writes the results of a test run in the given format. Interfaces are sorted by name.
+// The JSON format follows the versioned schema of Report.
+func WriteResults(w io.Writer, format Format, resultMap map[string]*IntFaceResult, meta RunMetadata) error {
+	names := slices.Sorted(maps.Keys(resultMap))
+	switch format {
+	case FormatText:
+		writeText(w, names, resultMap)
+		return nil
+	case FormatJSON:
+		js, err := json.Marshal(NewReport(names, resultMap, meta))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(js)
+		return err
+	case FormatCSV:
+		return writeCSV(w, names, resultMap)
+	case FormatMarkdown:
+		writeMarkdown(w, names, resultMap)
+		return nil
+	case FormatJUnit:
+		return writeJUnit(w, names, resultMap)
+	case FormatTAP:
+		writeTAP(w, names, resultMap)
+		return nil
+	}
+	return fmt.Errorf("unknown output format %s", format)
+}
+
+// PrintResultLine prints the human-readable result of an interface
+func PrintResultLine(name string, r *IntFaceResult) {
+	WriteResultLine(os.Stdout, name, r)
+}
+
+// WriteResultLine writes the human-readable result of an interface
+func WriteResultLine(w io.Writer, name string, r *IntFaceResult) {
+	var peer string
+	if r.Peer != nil {
+		peer = " " + r.Peer.String()
+	}
+	fmt.Fprintf(w, "[%-10s] V4: %-7s (%9s - Lost %d pkts - Hops %s) V6: %-7s (%9s - Lost %d pkts - Hops %s)%s\n", name, r.V4.ErrorText, formatLatency(r.V4.LatencyUs), r.V4.PacketsLost, formatHops(r.V4.Hops), r.V6.ErrorText, formatLatency(r.V6.LatencyUs), r.V6.PacketsLost, formatHops(r.V6.Hops), peer)
+	for _, source := range slices.Sorted(maps.Keys(r.BySource)) {
+		result := r.BySource[source]
+		fmt.Fprintf(w, "    from %-20s %-7s (%9s - Lost %d pkts - Hops %s)\n", source, result.ErrorText, formatLatency(result.LatencyUs), result.PacketsLost, formatHops(result.Hops))
+	}
+	for _, family := range []struct {
+		name   string
+		result *ListenResult
+	}{{"v4", r.V4}, {"v6", r.V6}} {
+		if family.result.Trace == nil {
+			continue
+		}
+		fmt.Fprintf(w, "    trace %s\n", family.name)
+		if len(family.result.Trace) == 0 {
+			fmt.Fprintf(w, "      no replies\n")
+		}
+		for _, hop := range family.result.Trace {
+			if hop.Address == nil {
+				fmt.Fprintf(w, "      %2d  *\n", hop.TTL)
+				continue
+			}
+			var destination string
+			if hop.Destination {
+				destination = " destination"
+			}
+			fmt.Fprintf(w, "      %2d  %-39s %9s%s\n", hop.TTL, hop.Address, formatLatency(hop.RTTUs), destination)
+		}
+	}
+	for _, family := range []struct {
+		name   string
+		result *ListenResult
+	}{{"v4", r.V4}, {"v6", r.V6}} {
+		if qos := family.result.QoS; qos != nil && qos.notable() {
+			fmt.Fprintf(w, "    qos %s %s\n", family.name, qos)
+		}
+		pathMTU := family.result.PathMTU
+		if pathMTU == nil {
+			continue
+		}
+		mtu := "-"
+		if pathMTU.MTU >= 0 {
+			mtu = strconv.Itoa(pathMTU.MTU)
+		}
+		fmt.Fprintf(w, "    mtu %s %s (interface %d)\n", family.name, mtu, pathMTU.InterfaceMTU)
+		for _, message := range pathMTU.TooBig {
+			fmt.Fprintf(w, "      %d bytes too big at %s, next-hop MTU %d\n", message.Size, message.Sender, message.MTU)
+		}
+	}
+	for _, session := range r.BGP {
+		fmt.Fprintf(w, "    bgp  %-20s %s AS%d\n", session.Protocol, session.State, session.NeighborAS)
+	}
+}
+
+// writeText writes the result lines followed by a summary of the failed interfaces
+func writeText(w io.Writer, names []string, resultMap map[string]*IntFaceResult) {
+	for _, name := range names {
+		WriteResultLine(w, name, resultMap[name])
+	}
+	if len(names) == 0 {
+		return
+	}
+	_, _ = fmt.Fprintln(w, "-- Failed interface summary --")
+	for _, name := range names {
+		result := resultMap[name]
+		var errors = make([]string, 0)
+		if result.V4.Status.Failed() {
+			errors = append(errors, fmt.Sprintf("Error (v4): %s", result.V4.ErrorText))
+		}
+		if result.V6.Status.Failed() {
+			errors = append(errors, fmt.Sprintf("Error (v6): %s", result.V6.ErrorText))
+		}
+		for _, source := range slices.Sorted(maps.Keys(result.BySource)) {
+			sourceResult := result.BySource[source]
+			if sourceResult == result.V4 || sourceResult == result.V6 {
+				continue
+			}
+			if sourceResult.Status.Failed() {
+				errors = append(errors, fmt.Sprintf("Error (%s): %s", source, sourceResult.ErrorText))
+			}
+		}
+		if len(errors) != 0 {
+			_, _ = fmt.Fprintf(w, "[%-10s] %s\n", name, strings.Join(errors, " "))
+		}
+	}
+}
+
+// testCase is the result of one address family, or of one source address if several were tested
+type testCase struct {
+	family string
+	source string
+	result *ListenResult
+}
+
+// familyResults returns the results of an interface in a stable order
+func (r *IntFaceResult) testCases() []testCase {
+	results := []testCase{{family: "ipv4", result: r.V4}, {family: "ipv6", result: r.V6}}
+	for _, source := range slices.Sorted(maps.Keys(r.BySource)) {
+		result := r.BySource[source]
+		if result == r.V4 || result == r.V6 {
+			continue
+		}
+		family := "ipv6"
+		if strings.Contains(source, ".") {
+			family = "ipv4"
+		}
+		results = append(results, testCase{family: family, source: source, result: result})
+	}
+	return results
+}
+
+func writeCSV(w io.Writer, names []string, resultMap map[string]*IntFaceResult) error {
+	writer := csv.NewWriter(w)
+	_ = writer.Write([]string{"interface", "family", "source", "status", "message", "latency_ms", "packets_lost", "ttl", "hops", "peer", "asn"})
+	for _, name := range names {
+		r := resultMap[name]
+		var peer, asn string
+		if r.Peer != nil {
+			peer = r.Peer.Name
+			if r.Peer.ASN != 0 {
+				asn = strconv.FormatUint(uint64(r.Peer.ASN), 10)
+			}
+		}
+		for _, f := range r.testCases() {
+			var latency, ttl, hops string
+			if f.result.LatencyUs >= 0 {
+				latency = strconv.FormatFloat(float64(f.result.LatencyUs)/1000, 'f', 3, 64)
+			}
+			if f.result.TTL >= 0 {
+				ttl = strconv.Itoa(int(f.result.TTL))
+			}
+			if f.result.Hops >= 0 {
+				hops = strconv.Itoa(f.result.Hops)
+			}
+			_ = writer.Write([]string{name, f.family, f.source, f.result.Status.String(), f.result.ErrorText,
+				latency, strconv.Itoa(f.result.PacketsLost), ttl, hops, peer, asn})
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeMarkdown(w io.Writer, names []string, resultMap map[string]*IntFaceResult) {
+	escape := strings.NewReplacer("|", "\\|", "\n", " ").Replace
+	cell := func(result *ListenResult) string {
+		if result.Status == OK {
+			return "OK, " + formatLatency(result.LatencyUs)
+		}
+		return escape(result.ErrorText)
+	}
+	_, _ = fmt.Fprintln(w, "| Interface | Peer | IPv4 | IPv6 |")
+	_, _ = fmt.Fprintln(w, "|-----------|------|------|------|")
+	for _, name := range names {
+		r := resultMap[name]
+		var peer string
+		if r.Peer != nil {
+			peer = escape(r.Peer.String())
+		}
+		_, _ = fmt.Fprintf(w, "| %s | %s | %s | %s |\n", escape(name), peer, cell(r.V4), cell(r.V6))
+	}
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Skipped   *junitMessage `xml:"skipped"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+}
+
+// writeJUnit writes a test case for every address family, grouped by interface as test class
+func writeJUnit(w io.Writer, names []string, resultMap map[string]*IntFaceResult) error {
+	suite := junitTestSuite{Name: "peertester", TestCases: make([]junitTestCase, 0)}
+	for _, name := range names {
+		for _, f := range resultMap[name].testCases() {
+			junitCase := junitTestCase{ClassName: name, Name: f.family, Time: "0"}
+			if f.source != "" {
+				junitCase.Name += " from " + f.source
+			}
+			if f.result.LatencyUs >= 0 {
+				junitCase.Time = strconv.FormatFloat(float64(f.result.LatencyUs)/1e6, 'f', 6, 64)
+			}
+			switch {
+			case !f.result.Status.Tested():
+				junitCase.Skipped = &junitMessage{Message: f.result.ErrorText}
+				suite.Skipped++
+			case f.result.Status.Failed():
+				junitCase.Failure = &junitMessage{Message: f.result.ErrorText, Type: f.result.Status.String()}
+				suite.Failures++
+			}
+			suite.TestCases = append(suite.TestCases, junitCase)
+		}
+	}
+	suite.Tests = len(suite.TestCases)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func writeTAP(w io.Writer, names []string, resultMap map[string]*IntFaceResult) {
+	lines := make([]string, 0)
+	for _, name := range names {
+		for _, f := range resultMap[name].testCases() {
+			description := name + " " + f.family
+			if f.source != "" {
+				description += " from " + f.source
+			}
+			// "#" starts a directive in TAP and is not allowed in descriptions
+			description = strings.ReplaceAll(description, "#", "")
+			switch {
+			case !f.result.Status.Tested():
+				lines = append(lines, fmt.Sprintf("ok %d - %s # SKIP %s", len(lines)+1, description, f.result.ErrorText))
+			case f.result.Status.Failed():
+				lines = append(lines, fmt.Sprintf("not ok %d - %s: %s", len(lines)+1, description, strings.ReplaceAll(f.result.ErrorText, "#", "")))
+			default:
+				lines = append(lines, fmt.Sprintf("ok %d - %s (%s)", len(lines)+1, description, formatLatency(f.result.LatencyUs)))
+			}
+		}
+	}
+	_, _ = fmt.Fprintln(w, "TAP version 13")
+	_, _ = fmt.Fprintf(w, "1..%d\n", len(lines))
+	for _, line := range lines {
+		_, _ = fmt.Fprintln(w, line)
+	}
+}
@@ -0,0 +1,81 @@
+package peerTester
+
+import (
+	"bytes"
+	"testing"
+)
+
+// formatResults returns results covering a passed, failed and skipped address family and an
+// additional source address
+func formatResults() map[string]*IntFaceResult {
+	a4 := newListenResult(OK, "OK")
+	a4.LatencyUs, a4.TTL, a4.Hops = 12345, 64, 0
+	a6 := newListenResult(Timeout, "Timeout")
+	a6.PacketsLost = 3
+	b6 := newListenResult(OK, "OK")
+	b6.LatencyUs, b6.TTL, b6.Hops = 1000, 63, 1
+	filtered := newListenResult(PeerFiltered, "Filtered | #1")
+	filtered.PacketsLost = 3
+	return map[string]*IntFaceResult{
+		"dn42_b": {
+			V4:       newListenResult(Disabled, "Disabled"),
+			V6:       b6,
+			BySource: map[string]*ListenResult{"fd00::1": b6, "fd00::2": filtered},
+		},
+		"dn42_a": {V4: a4, V6: a6, Peer: &PeerInfo{Name: "alice", ASN: 4242420001}},
+	}
+}
+
+func TestWriteResults(t *testing.T) {
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{FormatCSV, `interface,family,source,status,message,latency_ms,packets_lost,ttl,hops,peer,asn
+dn42_a,ipv4,,ok,OK,12.345,0,64,0,alice,4242420001
+dn42_a,ipv6,,timeout,Timeout,,3,,,alice,4242420001
+dn42_b,ipv4,,disabled,Disabled,,0,,,,
+dn42_b,ipv6,,ok,OK,1.000,0,63,1,,
+dn42_b,ipv6,fd00::2,peer_filtered,Filtered | #1,,3,,,,
+`},
+		{FormatMarkdown, `| Interface | Peer | IPv4 | IPv6 |
+|-----------|------|------|------|
+| dn42_a | alice (AS4242420001) | OK, 12.345ms | Timeout |
+| dn42_b |  | Disabled | OK, 1.000ms |
+`},
+		{FormatJUnit, `<?xml version="1.0" encoding="UTF-8"?>
+<testsuite name="peertester" tests="5" failures="2" skipped="1">
+  <testcase classname="dn42_a" name="ipv4" time="0.012345"></testcase>
+  <testcase classname="dn42_a" name="ipv6" time="0">
+    <failure message="Timeout" type="timeout"></failure>
+  </testcase>
+  <testcase classname="dn42_b" name="ipv4" time="0">
+    <skipped message="Disabled"></skipped>
+  </testcase>
+  <testcase classname="dn42_b" name="ipv6" time="0.001000"></testcase>
+  <testcase classname="dn42_b" name="ipv6 from fd00::2" time="0">
+    <failure message="Filtered | #1" type="peer_filtered"></failure>
+  </testcase>
+</testsuite>
+`},
+		{FormatTAP, `TAP version 13
+1..5
+ok 1 - dn42_a ipv4 (12.345ms)
+not ok 2 - dn42_a ipv6: Timeout
+ok 3 - dn42_b ipv4 # SKIP Disabled
+ok 4 - dn42_b ipv6 (1.000ms)
+not ok 5 - dn42_b ipv6 from fd00::2: Filtered | 1
+`},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var b bytes.Buffer
+			if err := WriteResults(&b, tt.format, formatResults(), RunMetadata{}); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("WriteResults() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
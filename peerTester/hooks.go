@@ -0,0 +1,199 @@
+package peerTester
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// hookTimeout limits the time a webhook request or an executable may take
+const hookTimeout = 30 * time.Second
+
+// StatusEvent is passed to the hooks when the status of an interface changed
+type StatusEvent struct {
+	Interface string    `json:"interface"`
+	Time      time.Time `json:"time"`
+	// Healthy is false if any tested address family failed
+	Healthy bool `json:"healthy"`
+	// V4 and V6 hold the status of each address family before and after the change
+	V4 FamilyChange `json:"v4"`
+	V6 FamilyChange `json:"v6"`
+	// Previous is the result the hooks were last notified of, or nil for the first notification
+	Previous *IntFaceResult `json:"previous"`
+	Result   *IntFaceResult `json:"result"`
+}
+
+// FamilyChange is the status of an address family before and after a change. Previous is empty
+// for the first notification of an interface.
+type FamilyChange struct {
+	Previous string `json:"previous,omitempty"`
+	Status   string `json:"status"`
+}
+
+// Hook is notified of status changes
+type Hook interface {
+	Notify(event *StatusEvent) error
+}
+
+// WebhookHook sends every event as JSON in an HTTP POST request
+type WebhookHook struct {
+	URL string
+}
+
+func (h *WebhookHook) Notify(event *StatusEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	_ = response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook %s returned %s", h.URL, response.Status)
+	}
+	return nil
+}
+
+func (h *WebhookHook) String() string {
+	return h.URL
+}
+
+// ExecHook runs an executable for every event. The event is passed as JSON on stdin, and the
+// interface name and health in the PEERTESTER_INTERFACE and PEERTESTER_HEALTHY environment variables.
+type ExecHook struct {
+	Path string
+}
+
+func (h *ExecHook) Notify(event *StatusEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, h.Path)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"PEERTESTER_INTERFACE="+event.Interface,
+		fmt.Sprintf("PEERTESTER_HEALTHY=%t", event.Healthy),
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %s %s", h.Path, err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+func (h *ExecHook) String() string {
+	return h.Path
+}
+
+// Notifier runs the hooks when the status of an interface changed. A change is only reported
+// once the status has not changed for the hold-down time, so that flapping interfaces do not
+// trigger the hooks on every change.
+type Notifier struct {
+	Hooks    []Hook
+	HoldDown time.Duration
+	// OnError is called with the errors of failed hooks
+	OnError func(hook Hook, err error)
+
+	mu         sync.Mutex
+	interfaces map[string]*notifierState
+}
+
+type notifierState struct {
+	// notified is the result the hooks were last notified of
+	notified *IntFaceResult
+	latest   *IntFaceResult
+	pending  *time.Timer
+	// generation is increased whenever the timer is stopped or replaced, so that a timer that
+	// already expired while waiting for the lock does not fire
+	generation int
+}
+
+func NewNotifier(hooks []Hook, holdDown time.Duration) *Notifier {
+	return &Notifier{
+		Hooks:      hooks,
+		HoldDown:   holdDown,
+		interfaces: make(map[string]*notifierState),
+	}
+}
+
+// StatusChanged is a StatusChangeFunc for ResultStore.OnStatusChange. The first result of an
+// interface only triggers the hooks if it is failing.
+func (n *Notifier) StatusChanged(name string, previous *IntFaceResult, state InterfaceState) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	s, ok := n.interfaces[name]
+	if !ok {
+		s = &notifierState{}
+		if state.Result.healthy() {
+			s.notified = state.Result
+		}
+		n.interfaces[name] = s
+	}
+	s.latest = state.Result
+
+	// Every change restarts the hold-down time
+	if s.pending != nil {
+		s.pending.Stop()
+		s.pending = nil
+		s.generation++
+	}
+	if s.notified != nil && s.notified.sameStatus(s.latest) {
+		// The interface returned to the notified status within the hold-down time
+		return
+	}
+	generation := s.generation
+	s.pending = time.AfterFunc(n.HoldDown, func() {
+		n.fire(name, s, generation)
+	})
+}
+
+func (n *Notifier) fire(name string, s *notifierState, generation int) {
+	n.mu.Lock()
+	if generation != s.generation {
+		n.mu.Unlock()
+		return
+	}
+	s.pending = nil
+	if s.notified != nil && s.notified.sameStatus(s.latest) {
+		n.mu.Unlock()
+		return
+	}
+	event := &StatusEvent{
+		Interface: name,
+		Time:      time.Now(),
+		Healthy:   s.latest.healthy(),
+		V4:        FamilyChange{Status: s.latest.V4.Status.String()},
+		V6:        FamilyChange{Status: s.latest.V6.Status.String()},
+		Previous:  s.notified,
+		Result:    s.latest,
+	}
+	if s.notified != nil {
+		event.V4.Previous = s.notified.V4.Status.String()
+		event.V6.Previous = s.notified.V6.Status.String()
+	}
+	s.notified = s.latest
+	n.mu.Unlock()
+
+	for _, hook := range n.Hooks {
+		if err := hook.Notify(event); err != nil && n.OnError != nil {
+			n.OnError(hook, err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package peerTester
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// webhookStub is an HTTP server that records the events posted to it
+type webhookStub struct {
+	server *httptest.Server
+	events chan received
+}
+
+type received struct {
+	event StatusEvent
+	time  time.Time
+}
+
+func newWebhookStub(t *testing.T, status int) *webhookStub {
+	stub := &webhookStub{events: make(chan received, 16)}
+	stub.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request %s with content type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		var event StatusEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("decoding event: %s", err)
+		}
+		stub.events <- received{event: event, time: time.Now()}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(stub.server.Close)
+	return stub
+}
+
+func statusResult(v4 testResult) *IntFaceResult {
+	return &IntFaceResult{V4: newListenResult(v4, v4.String()), V6: newListenResult(OK, "OK")}
+}
+
+func TestWebhookHook(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{"accepted", http.StatusNoContent, false},
+		{"rejected", http.StatusInternalServerError, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newWebhookStub(t, tt.status)
+			hook := &WebhookHook{URL: stub.server.URL}
+			err := hook.Notify(&StatusEvent{Interface: "dn42_test", V4: FamilyChange{Previous: "ok", Status: "timeout"}, Result: statusResult(Timeout)})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Notify() error = %v, want error %t", err, tt.wantErr)
+			}
+			got := (<-stub.events).event
+			if got.Interface != "dn42_test" || got.V4.Status != "timeout" || got.Result.V4.Status != Timeout {
+				t.Errorf("posted event = %+v", got)
+			}
+		})
+	}
+}
+
+func TestNotifierHoldDown(t *testing.T) {
+	const holdDown = 200 * time.Millisecond
+	tests := []struct {
+		name string
+		// steps are the V4 statuses reported, one every gap
+		steps []testResult
+		gap   time.Duration
+		// want is the V4 status of every expected event, with the previous status
+		want []FamilyChange
+	}{
+		{"flap is suppressed", []testResult{OK, Timeout, OK}, 50 * time.Millisecond, nil},
+		{"change is reported", []testResult{OK, Timeout}, 0, []FamilyChange{{Previous: "ok", Status: "timeout"}}},
+		{"every change restarts the hold-down", []testResult{OK, Timeout, PeerFiltered}, 150 * time.Millisecond,
+			[]FamilyChange{{Previous: "ok", Status: "peer_filtered"}}},
+		{"first failing result is reported", []testResult{Timeout}, 0, []FamilyChange{{Status: "timeout"}}},
+		{"first healthy result is not reported", []testResult{OK}, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			stub := newWebhookStub(t, http.StatusOK)
+			n := NewNotifier([]Hook{&WebhookHook{URL: stub.server.URL}}, holdDown)
+			n.OnError = func(hook Hook, err error) { t.Errorf("hook %s: %s", hook, err) }
+
+			var last time.Time
+			for i, status := range tt.steps {
+				if i != 0 {
+					time.Sleep(tt.gap)
+				}
+				last = time.Now()
+				n.StatusChanged("dn42_test", nil, InterfaceState{Result: statusResult(status)})
+			}
+
+			timeout := time.After(3 * holdDown)
+			for _, want := range tt.want {
+				select {
+				case r := <-stub.events:
+					if r.event.V4 != want {
+						t.Errorf("event V4 = %+v, want %+v", r.event.V4, want)
+					}
+					if elapsed := r.time.Sub(last); elapsed < holdDown {
+						t.Errorf("event sent %s after the last change, before the hold-down of %s", elapsed, holdDown)
+					}
+				case <-timeout:
+					t.Fatalf("no event received, want %+v", want)
+				}
+			}
+			select {
+			case r := <-stub.events:
+				t.Errorf("unexpected event %+v", r.event.V4)
+			case <-timeout:
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package peerTester
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	icmpDestinationUnreachable   = 3
+	icmpFragmentationNeeded      = 4
+	icmpTimeExceeded             = 11
+	icmpv6DestinationUnreachable = 1
+	icmpv6PacketTooBig           = 2
+	icmpv6TimeExceeded           = 3
+	protocolUDP                  = 17
+)
+
+// ICMPError is an ICMP or ICMPv6 error message received in response to a probe
+type ICMPError struct {
+	Type   uint8
+	Code   uint8
+	Sender net.IP
+}
+
+// icmpMessage is an ICMP or ICMPv6 error quoting one of our probes
+type icmpMessage struct {
+	icmpType uint8
+	code     uint8
+	from     net.IP
+	// source is the source address of the quoted probe
+	source net.IP
+	// hop is the TTL of a traceroute probe, encoded in its payload length
+	hop int
+	// size is the size of the quoted probe as it was sent
+	size int
+	// mtu is the next-hop MTU of Fragmentation Needed and Packet Too Big messages
+	mtu int
+}
+
+func (m *icmpMessage) timeExceeded(isV4 bool) bool {
+	if isV4 {
+		return m.icmpType == icmpTimeExceeded
+	}
+	return m.icmpType == icmpv6TimeExceeded
+}
+
+// status classifies Destination Unreachable messages. Port unreachable is reported as filtered,
+// as it is the default reply of firewall REJECT rules.
+func (m *icmpMessage) status(isV4 bool) (testResult, bool) {
+	if isV4 {
+		if m.icmpType != icmpDestinationUnreachable {
+			return 0, false
+		}
+		switch m.code {
+		case 0, 1, 5, 6, 7, 11, 12: // Network, host or source route failures
+			return PeerNoRoute, true
+		case 2, 3, 9, 10, 13: // Protocol or port unreachable, administratively prohibited
+			return PeerFiltered, true
+		}
+		return 0, false
+	}
+	if m.icmpType != icmpv6DestinationUnreachable {
+		return 0, false
+	}
+	switch m.code {
+	case 0, 2, 3, 6: // No route, beyond scope, address unreachable, reject route
+		return PeerNoRoute, true
+	case 1, 4, 5: // Administratively prohibited, port unreachable, source address policy
+		return PeerFiltered, true
+	}
+	return 0, false
+}
+
+func (m *icmpMessage) tooBig(isV4 bool) bool {
+	if isV4 {
+		return m.icmpType == icmpDestinationUnreachable && m.code == icmpFragmentationNeeded
+	}
+	return m.icmpType == icmpv6PacketTooBig
+}
+
+func (m *icmpMessage) export() *ICMPError {
+	return &ICMPError{Type: m.icmpType, Code: m.code, Sender: m.from}
+}
+
+// openICMPListener opens a raw socket receiving the ICMP or ICMPv6 messages sent to this host
+func openICMPListener(isV4 bool) (*net.IPConn, error) {
+	network, address := "ip6:ipv6-icmp", "::"
+	if isV4 {
+		network, address = "ip4:icmp", "0.0.0.0"
+	}
+	conn, err := net.ListenIP(network, &net.IPAddr{IP: net.ParseIP(address)})
+	if err != nil {
+		return nil, fmt.Errorf("could not open ICMP listener: %s", err)
+	}
+	return conn, nil
+}
+
+func listenICMPIntoChannel(conn *net.IPConn, isV4 bool, port int, dispatcher *resultDispatcher, stopChannel chan bool, wg *sync.WaitGroup) {
+	var stopping atomic.Bool
+
+	go func() {
+		<-stopChannel
+		stopping.Store(true)
+		_ = conn.SetDeadline(time.Now())
+	}()
+
+	buf := make([]byte, 1500)
+	for {
+		numRead, remote, err := conn.ReadFromIP(buf)
+		receiveTime := time.Now()
+		if err != nil {
+			if stopping.Load() {
+				break
+			}
+			continue
+		}
+
+		counter, message, ok := parseICMPError(buf[:numRead], isV4, port)
+		if !ok {
+			continue
+		}
+		message.from = remote.IP
+		dispatcher.dispatch(counter, &ListenResult{
+			remoteIP: remote.IP,
+			receiveTime: timeInfo{
+				id:   uint8(message.hop),
+				time: receiveTime,
+			},
+			isV4:         isV4,
+			trafficClass: -1,
+			TTL:          -1,
+			Hops:         -1,
+			icmp:         message,
+		})
+	}
+	_ = conn.Close()
+	wg.Done()
+}
+
+// parseICMPError returns the counter of the probe quoted by an ICMP error message. Only
+// UDP packets sent to port are accepted. If the message quotes the complete payload, its HMAC
+// must be valid.
+func parseICMPError(b []byte, isV4 bool, port int) (uint16, *icmpMessage, bool) {
+	if len(b) < 8 {
+		return 0, nil, false
+	}
+	message := &icmpMessage{icmpType: b[0], code: b[1]}
+	// Error messages quote the original packet after the 8 byte ICMP header
+	quoted := b[8:]
+
+	var counter uint16
+	var udp []byte
+	if isV4 {
+		if (b[0] != icmpDestinationUnreachable && b[0] != icmpTimeExceeded) || len(quoted) < 20 {
+			return 0, nil, false
+		}
+		headerLength := int(quoted[0]&0x0f) * 4
+		if quoted[9] != protocolUDP || len(quoted) < headerLength+8 {
+			return 0, nil, false
+		}
+		if b[0] == icmpDestinationUnreachable && b[1] == icmpFragmentationNeeded {
+			message.mtu = int(binary.BigEndian.Uint16(b[6:8]))
+		}
+		message.size = headerLength
+		counter = binary.BigEndian.Uint16(quoted[4:6])
+		message.source = net.IP(append([]byte(nil), quoted[12:16]...))
+		udp = quoted[headerLength:]
+	} else {
+		if (b[0] != icmpv6DestinationUnreachable && b[0] != icmpv6PacketTooBig && b[0] != icmpv6TimeExceeded) || len(quoted) < 48 {
+			return 0, nil, false
+		}
+		if quoted[6] != protocolUDP {
+			return 0, nil, false
+		}
+		if b[0] == icmpv6PacketTooBig {
+			message.mtu = int(binary.BigEndian.Uint32(b[4:8]))
+		}
+		message.size = 40
+		counter = uint16(binary.BigEndian.Uint32(quoted[0:4]) & 0xfffff)
+		message.source = net.IP(append([]byte(nil), quoted[8:24]...))
+		udp = quoted[40:]
+	}
+
+	if int(binary.BigEndian.Uint16(udp[2:4])) != port {
+		return 0, nil, false
+	}
+	udpLength := int(binary.BigEndian.Uint16(udp[4:6]))
+	if udpLength > 8 && len(udp) >= udpLength {
+		opened := hmacOpen([16]byte(hmacKey), udp[8:udpLength])
+		if len(opened) < 4 || uint16(opened[1])|uint16(opened[0])<<8 != counter {
+			return 0, nil, false
+		}
+	}
+	message.size += udpLength
+	// UDP header, payload contents and HMAC, followed by the traceroute padding
+	message.hop = udpLength - 8 - 4 - sha256.Size
+	return counter, message, true
+}
+
+// warnNonLocalSources warns once for every probe source address that is not assigned to this
+// host. ICMP errors are sent to the source of the probe and never reach the listener then.
+func (t *Tester) warnNonLocalSources(sources []net.IP) {
+	if OutputJSON {
+		return
+	}
+	for _, source := range sources {
+		if _, checked := t.warnedSources.LoadOrStore(source.String(), true); checked {
+			continue
+		}
+		if !isLocalAddress(source) {
+			fmt.Printf(" -- Warning: source %s is not a local address, ICMP errors caused by its probes cannot be received\n", source)
+		}
+	}
+}
+
+// isLocalAddress reports whether the address is assigned to an interface of this host. It
+// returns true if the addresses cannot be read.
+func isLocalAddress(ip net.IP) bool {
+	addresses, err := net.InterfaceAddrs()
+	if err != nil {
+		return true
+	}
+	for _, address := range addresses {
+		if ipNet, ok := address.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
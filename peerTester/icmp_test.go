@@ -0,0 +1,138 @@
+package peerTester
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// icmpErrorQuoting returns an ICMP error message of the given type quoting a probe with the
+// counter, padded to encode the hop like a traceroute probe. rest is the second word of the
+// ICMP header, holding the MTU of Fragmentation Needed and Packet Too Big messages.
+func icmpErrorQuoting(t *testing.T, isV4 bool, icmpType uint8, code uint8, rest uint32, counter uint16, hop int) []byte {
+	contents := make([]byte, 4+hop)
+	contents[0] = byte(counter >> 8)
+	contents[1] = byte(counter)
+	payload := hmacSeal([16]byte(hmacKey), contents)
+
+	var probe []byte
+	var err error
+	ip := ipOptions{ttl: 1, id: counter}
+	if isV4 {
+		probe, err = buildUDPPacket(&net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 5000},
+			&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 6000}, payload, ip)
+	} else {
+		probe, err = buildUDPPacket6(&net.UDPAddr{IP: net.ParseIP("fd00::2"), Port: 5000},
+			&net.UDPAddr{IP: net.ParseIP("fd00::1"), Port: 6000}, payload, ip)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make([]byte, 8)
+	header[0], header[1] = icmpType, code
+	binary.BigEndian.PutUint32(header[4:8], rest)
+	return append(header, probe...)
+}
+
+func TestParseICMPError(t *testing.T) {
+	newHmacKey()
+	const counter = 0x1234
+	// Size of a probe without traceroute padding: UDP header, contents and HMAC
+	const udpSize = 8 + 4 + 32
+	source4 := net.ParseIP("10.0.0.1").To4()
+	source6 := net.ParseIP("fd00::1")
+	tests := []struct {
+		name    string
+		isV4    bool
+		message []byte
+		// mutate changes the message before it is parsed
+		mutate func(b []byte) []byte
+		port   int
+		want   *icmpMessage
+	}{
+		{"IPv4 port unreachable", true, icmpErrorQuoting(t, true, icmpDestinationUnreachable, 3, 0, counter, 0), nil, 5000,
+			&icmpMessage{icmpType: icmpDestinationUnreachable, code: 3, source: source4, size: 20 + udpSize}},
+		{"IPv4 fragmentation needed", true, icmpErrorQuoting(t, true, icmpDestinationUnreachable, icmpFragmentationNeeded, 1400, counter, 0), nil, 5000,
+			&icmpMessage{icmpType: icmpDestinationUnreachable, code: icmpFragmentationNeeded, source: source4, size: 20 + udpSize, mtu: 1400}},
+		{"IPv4 time exceeded", true, icmpErrorQuoting(t, true, icmpTimeExceeded, 0, 0, counter, 3), nil, 5000,
+			&icmpMessage{icmpType: icmpTimeExceeded, source: source4, size: 20 + udpSize + 3, hop: 3}},
+		{"IPv4 quote of the UDP header only", true, icmpErrorQuoting(t, true, icmpDestinationUnreachable, 3, 0, counter, 0),
+			func(b []byte) []byte { return b[:8+20+8] }, 5000,
+			&icmpMessage{icmpType: icmpDestinationUnreachable, code: 3, source: source4, size: 20 + udpSize}},
+		{"IPv4 invalid HMAC", true, icmpErrorQuoting(t, true, icmpDestinationUnreachable, 3, 0, counter, 0),
+			func(b []byte) []byte { b[len(b)-1] ^= 0xff; return b }, 5000, nil},
+		{"IPv4 other port", true, icmpErrorQuoting(t, true, icmpDestinationUnreachable, 3, 0, counter, 0), nil, 5001, nil},
+		{"IPv4 not UDP", true, icmpErrorQuoting(t, true, icmpDestinationUnreachable, 3, 0, counter, 0),
+			func(b []byte) []byte { b[8+9] = 6; return b }, 5000, nil},
+		{"IPv4 echo reply", true, icmpErrorQuoting(t, true, 0, 0, 0, counter, 0), nil, 5000, nil},
+		{"IPv4 truncated", true, icmpErrorQuoting(t, true, icmpDestinationUnreachable, 3, 0, counter, 0),
+			func(b []byte) []byte { return b[:8+19] }, 5000, nil},
+		{"IPv6 port unreachable", false, icmpErrorQuoting(t, false, icmpv6DestinationUnreachable, 4, 0, counter, 0), nil, 5000,
+			&icmpMessage{icmpType: icmpv6DestinationUnreachable, code: 4, source: source6, size: 40 + udpSize}},
+		{"IPv6 packet too big", false, icmpErrorQuoting(t, false, icmpv6PacketTooBig, 0, 1280, counter, 0), nil, 5000,
+			&icmpMessage{icmpType: icmpv6PacketTooBig, source: source6, size: 40 + udpSize, mtu: 1280}},
+		{"IPv6 time exceeded", false, icmpErrorQuoting(t, false, icmpv6TimeExceeded, 0, 0, counter, 5), nil, 5000,
+			&icmpMessage{icmpType: icmpv6TimeExceeded, source: source6, size: 40 + udpSize + 5, hop: 5}},
+		{"IPv6 echo reply", false, icmpErrorQuoting(t, false, 129, 0, 0, counter, 0), nil, 5000, nil},
+		{"IPv6 truncated", false, icmpErrorQuoting(t, false, icmpv6DestinationUnreachable, 4, 0, counter, 0),
+			func(b []byte) []byte { return b[:8+47] }, 5000, nil},
+		{"short message", true, []byte{icmpDestinationUnreachable, 3, 0, 0}, nil, 5000, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.message
+			if tt.mutate != nil {
+				b = tt.mutate(b)
+			}
+			gotCounter, got, ok := parseICMPError(b, tt.isV4, tt.port)
+			if ok != (tt.want != nil) {
+				t.Fatalf("parseICMPError() ok = %t, want %t", ok, tt.want != nil)
+			}
+			if !ok {
+				return
+			}
+			if gotCounter != counter {
+				t.Errorf("parseICMPError() counter = %#x, want %#x", gotCounter, counter)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseICMPError() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestICMPMessageStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		isV4     bool
+		icmpType uint8
+		code     uint8
+		want     testResult
+		wantOK   bool
+	}{
+		{"IPv4 network unreachable", true, icmpDestinationUnreachable, 0, PeerNoRoute, true},
+		{"IPv4 host unreachable", true, icmpDestinationUnreachable, 1, PeerNoRoute, true},
+		{"IPv4 port unreachable", true, icmpDestinationUnreachable, 3, PeerFiltered, true},
+		{"IPv4 administratively prohibited", true, icmpDestinationUnreachable, 13, PeerFiltered, true},
+		{"IPv4 fragmentation needed", true, icmpDestinationUnreachable, icmpFragmentationNeeded, 0, false},
+		{"IPv4 time exceeded", true, icmpTimeExceeded, 0, 0, false},
+		{"IPv6 no route", false, icmpv6DestinationUnreachable, 0, PeerNoRoute, true},
+		{"IPv6 address unreachable", false, icmpv6DestinationUnreachable, 3, PeerNoRoute, true},
+		{"IPv6 reject route", false, icmpv6DestinationUnreachable, 6, PeerNoRoute, true},
+		{"IPv6 administratively prohibited", false, icmpv6DestinationUnreachable, 1, PeerFiltered, true},
+		{"IPv6 port unreachable", false, icmpv6DestinationUnreachable, 4, PeerFiltered, true},
+		{"IPv6 unknown code", false, icmpv6DestinationUnreachable, 7, 0, false},
+		{"IPv6 packet too big", false, icmpv6PacketTooBig, 0, 0, false},
+		{"IPv6 type of IPv4 message", false, icmpDestinationUnreachable, 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &icmpMessage{icmpType: tt.icmpType, code: tt.code}
+			got, ok := m.status(tt.isV4)
+			if ok != tt.wantOK || (ok && got != tt.want) {
+				t.Errorf("status() = %s, %t, want %s, %t", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -3,14 +3,10 @@ package peerTester
 import (
 	"fmt"
 	"net"
-	"os"
-	"strings"
 	"syscall"
 	"time"
 )
 
-const packetCount uint8 = 2
-
 func open(intFace *net.Interface) (int, error) {
 	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, 0)
 	if err != nil {
@@ -18,13 +14,6 @@ func open(intFace *net.Interface) (int, error) {
 	}
 
 	if intFace != nil {
-		intType, _ := os.ReadFile("/sys/class/net/" + intFace.Name + "/type")
-		if intType != nil {
-			if strings.TrimSpace(string(intType)) != "65534" {
-				return -1, fmt.Errorf("%s is not a layer 3 interface", intFace.Name)
-			}
-		}
-
 		err = syscall.Bind(fd, &syscall.SockaddrLinklayer{
 			Protocol: 0,
 			Ifindex:  intFace.Index,
@@ -34,28 +23,17 @@ func open(intFace *net.Interface) (int, error) {
 			Addr:     [8]byte{},
 		})
 		if err != nil {
+			_ = syscall.Close(fd)
 			return -1, fmt.Errorf("could not bind socket to device: %s", err)
 		}
 	}
 	return fd, nil
 }
 
-func sendOnInterface(intFace net.Interface, srcIP, srcIP6, dstIP, dstIP6 net.IP, counter int) ([]timeInfo, error) {
-	dst := &net.UDPAddr{
-		IP:   dstIP,
-		Port: 5000,
-	}
-	src := &net.UDPAddr{
-		IP:   srcIP,
-		Port: 5000,
-	}
-	dst6 := &net.UDPAddr{
-		IP:   dstIP6,
-		Port: 5000,
-	}
-	src6 := &net.UDPAddr{
-		IP:   srcIP6,
-		Port: 5000,
+func sendOnInterface(intFace net.Interface, sources []net.IP, dstIP, dstIP6 net.IP, counter uint16, opts TestOptions) ([]timeInfo, error) {
+	link, err := newLinkFraming(&intFace, opts)
+	if err != nil {
+		return nil, err
 	}
 
 	conn, err := open(&intFace)
@@ -66,77 +44,88 @@ func sendOnInterface(intFace net.Interface, srcIP, srcIP6, dstIP, dstIP6 net.IP,
 		_ = syscall.Close(fd)
 	}(conn)
 
-	var measurements = make([]timeInfo, 0)
-	var id = 0
-	for i := 0; i < int(packetCount); i++ {
-		var contents = make([]byte, 3)
-		contents[0] = byte(uint16(counter) >> 8)
-		contents[1] = byte(uint16(counter))
-
-		// IPv4
-		contents[2] = byte(id)
-		toSendV4 := hmacSeal([16]byte(hmacKey), contents)
-
-		b4, err := buildUDPPacket(dst, src, toSendV4)
-		if err != nil {
-			return nil, err
-		}
-
-		var t time.Time
-		var errorFirst = false
-		t, err = sendOnInterfaceBytes(conn, b4)
-		if err != nil {
-			errorFirst = true
-		}
-		measurements = append(measurements, timeInfo{
-			id:   uint8(id),
-			time: t,
-		})
-		// ---------------
-
-		time.Sleep(15 * time.Millisecond)
-
-		// IPv6
-		id++
-		contents[2] = byte(id)
-		toSendV6 := hmacSeal([16]byte(hmacKey), contents)
-
-		b6, err := buildUDPPacket6(dst6, src6, toSendV6)
-		if err != nil {
-			return nil, err
-		}
+	// Fall back to userspace timestamps if the kernel does not support TX timestamping
+	txTimestamps := enableTxTimestamps(conn) == nil
+	// txKey is the number of the next packet, which the kernel attaches to its TX timestamps
+	var txKey uint32
 
-		t, err = sendOnInterfaceBytes(conn, b6)
-		if err != nil {
-			if errorFirst {
+	var measurements = make([]timeInfo, 0)
+	for i := 0; i < opts.ProbeCount; i++ {
+		var sendErrors = 0
+		for sourceIndex, srcIP := range sources {
+			var contents = make([]byte, 4)
+			contents[0] = byte(counter >> 8)
+			contents[1] = byte(counter)
+			contents[2] = byte(sourceIndex)
+			contents[3] = byte(i)
+			toSend := hmacSeal([16]byte(hmacKey), contents)
+
+			src := &net.UDPAddr{
+				IP:   srcIP,
+				Port: opts.sourcePort(),
+			}
+			var b []byte
+			ip := ipOptions{ttl: probeTTL, id: counter, tos: opts.trafficClass()}
+			if srcIP.To4() != nil {
+				b, err = buildUDPPacket(&net.UDPAddr{IP: dstIP, Port: opts.port}, src, toSend, ip)
+			} else {
+				b, err = buildUDPPacket6(&net.UDPAddr{IP: dstIP6, Port: opts.port}, src, toSend, ip)
+			}
+			if err != nil {
+				return nil, err
+			}
+			isV4 := srcIP.To4() != nil
+			b, err = link.frame(b, isV4)
+			if err != nil {
 				return nil, err
 			}
-		}
-		measurements = append(measurements, timeInfo{
-			id:   uint8(id),
-			time: t,
-		})
-		// ---------------
 
-		if i != int(packetCount) {
-			time.Sleep(15 * time.Millisecond)
+			t, err := sendOnInterfaceBytes(conn, b, link.sockaddr(isV4), txTimestamps, txKey)
+			if err == nil {
+				txKey++
+			} else {
+				// A failed send may or may not have used a packet number, so the numbers of the
+				// following timestamps are unknown
+				txTimestamps = false
+				sendErrors++
+				if sendErrors == len(sources) {
+					return nil, err
+				}
+			}
+			t.id = uint8(i)
+			t.sourceIndex = uint8(sourceIndex)
+			t.srcPort = src.Port
+			measurements = append(measurements, t)
+
+			if i != opts.ProbeCount-1 || sourceIndex != len(sources)-1 {
+				time.Sleep(opts.ProbeInterval)
+			}
 		}
-		id++
 	}
 	return measurements, nil
 }
 
 type timeInfo struct {
-	id   uint8
-	time time.Time
+	id          uint8
+	sourceIndex uint8
+	time        time.Time
+	kernel      bool
+	// srcPort is the UDP source port of a sent probe
+	srcPort int
 }
 
-func sendOnInterfaceBytes(conn int, packetBytes []byte) (time.Time, error) {
-	t := time.Now()
-	_, err := syscall.Write(conn, packetBytes)
+func sendOnInterfaceBytes(conn int, packetBytes []byte, to *syscall.SockaddrLinklayer, txTimestamps bool, txKey uint32) (timeInfo, error) {
+	t := timeInfo{time: time.Now()}
+	err := syscall.Sendto(conn, packetBytes, 0, to)
 	if err != nil {
 		return t, err
 	}
 
+	if txTimestamps {
+		if ts, ok := readTxTimestamp(conn, txKey); ok {
+			t.time = ts
+			t.kernel = true
+		}
+	}
 	return t, nil
 }
@@ -1,7 +1,12 @@
 package peerTester
 
 import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
 	"net"
+	"slices"
+	"time"
 )
 
 type testResult int
@@ -11,12 +16,335 @@ const (
 	Timeout                  = iota
 	InvalidIP                = iota
 	UnexpectedTTL            = iota
+	// Disabled is reported for address families that are not tested because of the configuration
+	Disabled = iota
+	// NotConfigured is reported for address families without an address or route on the interface
+	NotConfigured = iota
+	// PeerNoRoute and PeerFiltered are reported if probes were answered with ICMP Destination Unreachable
+	PeerNoRoute  = iota
+	PeerFiltered = iota
+	// PortRewritten and PayloadTampered are reported if probes arrived with a changed source
+	// port or payload. Changed source addresses are reported as InvalidIP.
+	PortRewritten   = iota
+	PayloadTampered = iota
 )
 
+func (r testResult) String() string {
+	switch r {
+	case OK:
+		return "ok"
+	case Timeout:
+		return "timeout"
+	case InvalidIP:
+		return "invalid_ip"
+	case UnexpectedTTL:
+		return "unexpected_ttl"
+	case Disabled:
+		return "disabled"
+	case NotConfigured:
+		return "not_configured"
+	case PeerNoRoute:
+		return "peer_no_route"
+	case PeerFiltered:
+		return "peer_filtered"
+	case PortRewritten:
+		return "port_rewritten"
+	case PayloadTampered:
+		return "payload_tampered"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalJSON encodes the result by its name, as listed in the JSON result schema
+func (r testResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+// UnmarshalJSON also accepts the numbers written by earlier versions, e.g. in the run log
+func (r *testResult) UnmarshalJSON(b []byte) error {
+	var number int
+	if err := json.Unmarshal(b, &number); err == nil {
+		*r = testResult(number)
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(b, &name); err != nil {
+		return err
+	}
+	for result := OK; result <= PayloadTampered; result++ {
+		if result.String() == name {
+			*r = result
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown status %s", name)
+}
+
+// Failed reports whether the result counts as a failure
+func (r testResult) Failed() bool {
+	return r != OK && r.Tested()
+}
+
+// Tested reports whether the address family was tested
+func (r testResult) Tested() bool {
+	return r != Disabled && r != NotConfigured
+}
+
 var SourceIPv4 = net.ParseIP("172.20.0.53")
 var SourceIPv6 = net.ParseIP("fd42:d42:d42:54::1")
 var OutputJSON bool
 
+// Concurrency is the maximum number of interfaces tested at the same time
+var Concurrency = 16
+
+// Family is a set of address families
+type Family int
+
+const (
+	FamilyIPv4 Family = 1 << iota
+	FamilyIPv6
+	FamilyAll = FamilyIPv4 | FamilyIPv6
+)
+
+// PeerInfo describes the peer behind an interface
+type PeerInfo struct {
+	Name string
+	ASN  uint32
+}
+
+func (p *PeerInfo) String() string {
+	switch {
+	case p.ASN == 0:
+		return p.Name
+	case p.Name == "":
+		return fmt.Sprintf("AS%d", p.ASN)
+	default:
+		return fmt.Sprintf("%s (AS%d)", p.Name, p.ASN)
+	}
+}
+
+// maxProbeCount is limited by the single byte probe id in the payload
+const maxProbeCount = 255
+
+// maxSources is the maximum number of source addresses per address family
+const maxSources = 16
+
+// TestOptions controls how each interface is probed
+type TestOptions struct {
+	// ProbeCount is the number of probes sent per source address
+	ProbeCount int
+	// ProbeInterval is the spacing between two consecutive probes
+	ProbeInterval time.Duration
+	// Timeout is how long to wait for replies after the last probe was sent
+	Timeout time.Duration
+	// Sources4 and Sources6 are the source addresses of the probes. SourceIPv4 and SourceIPv6 are
+	// used if empty. Every source address is tested separately.
+	Sources4 []net.IP
+	Sources6 []net.IP
+	// SourcePort is the UDP source port of the probes. The destination port is used if zero.
+	SourcePort int
+	// RandomSourcePort selects a random source port for every probe
+	RandomSourcePort bool
+	// PeerMAC is the link-layer address of the peer on ethernet-like interfaces. It is resolved
+	// with the neighbour table, ARP or NDP if nil.
+	PeerMAC net.HardwareAddr
+	// Neighbor4 and Neighbor6 are the peer's addresses on the link, used to resolve PeerMAC
+	Neighbor4 net.IP
+	Neighbor6 net.IP
+	// Families are the address families to test. Both are tested if zero.
+	Families Family
+	// ExpectedHops is the number of routers the probes are expected to pass. The peer's router
+	// alone is one hop, which results in a received TTL of 63.
+	ExpectedHops int
+	// Destination4 and Destination6 replace the destination addresses of a test run
+	Destination4 net.IP
+	Destination6 net.IP
+	// Peer is attached to the results of the interface
+	Peer *PeerInfo
+	// Traceroute runs a traceroute for address families that time out or arrive with an unexpected TTL
+	Traceroute bool
+	// PathMTU searches the largest packet size that comes back through the peer
+	PathMTU bool
+	// DSCP and ECN are the bits the probes are marked with in the IPv4 TOS and IPv6 traffic class
+	DSCP int
+	ECN  int
+	// SkipFamilyDetection tests address families even if the interface has no address or route for them
+	SkipFamilyDetection bool
+	// BIRD is used to attach the BGP sessions running over the interface to the results
+	BIRD *BIRDClient
+	// Overrides holds per-interface options. Non-zero fields replace the options above.
+	Overrides map[string]TestOptions
+
+	// port is the destination port, set by the Tester
+	port int
+	// bgp holds the BGP sessions of every interface, read once per run by PerformTests
+	bgp map[string][]BGPSession
+}
+
+func DefaultTestOptions() TestOptions {
+	return TestOptions{
+		ProbeCount:    2,
+		ProbeInterval: 15 * time.Millisecond,
+		Timeout:       2 * time.Second,
+	}
+}
+
+// ForInterface returns the options to use for the named interface
+func (o TestOptions) ForInterface(name string) TestOptions {
+	override, ok := o.Overrides[name]
+	if !ok {
+		return o
+	}
+	return o.Merge(override)
+}
+
+// Merge returns the options with all non-zero fields of override applied
+func (o TestOptions) Merge(override TestOptions) TestOptions {
+	if override.ProbeCount != 0 {
+		o.ProbeCount = override.ProbeCount
+	}
+	if override.ProbeInterval != 0 {
+		o.ProbeInterval = override.ProbeInterval
+	}
+	if override.Timeout != 0 {
+		o.Timeout = override.Timeout
+	}
+	if len(override.Sources4) != 0 {
+		o.Sources4 = override.Sources4
+	}
+	if len(override.Sources6) != 0 {
+		o.Sources6 = override.Sources6
+	}
+	if override.SourcePort != 0 {
+		o.SourcePort = override.SourcePort
+	}
+	if override.RandomSourcePort {
+		o.RandomSourcePort = true
+	}
+	if override.PeerMAC != nil {
+		o.PeerMAC = override.PeerMAC
+	}
+	if override.Neighbor4 != nil {
+		o.Neighbor4 = override.Neighbor4
+	}
+	if override.Neighbor6 != nil {
+		o.Neighbor6 = override.Neighbor6
+	}
+	if override.Families != 0 {
+		o.Families = override.Families
+	}
+	if override.ExpectedHops != 0 {
+		o.ExpectedHops = override.ExpectedHops
+	}
+	if override.Destination4 != nil {
+		o.Destination4 = override.Destination4
+	}
+	if override.Destination6 != nil {
+		o.Destination6 = override.Destination6
+	}
+	if override.Peer != nil {
+		o.Peer = override.Peer
+	}
+	if override.Traceroute {
+		o.Traceroute = true
+	}
+	if override.PathMTU {
+		o.PathMTU = true
+	}
+	if override.DSCP != 0 {
+		o.DSCP = override.DSCP
+	}
+	if override.ECN != 0 {
+		o.ECN = override.ECN
+	}
+	if override.SkipFamilyDetection {
+		o.SkipFamilyDetection = true
+	}
+	if override.BIRD != nil {
+		o.BIRD = override.BIRD
+	}
+	return o
+}
+
+func (o TestOptions) normalize() TestOptions {
+	defaults := DefaultTestOptions()
+	if o.ProbeCount <= 0 {
+		o.ProbeCount = defaults.ProbeCount
+	}
+	o.ProbeCount = min(o.ProbeCount, maxProbeCount)
+	if o.ProbeInterval < 0 {
+		o.ProbeInterval = 0
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = defaults.Timeout
+	}
+	if len(o.Sources4) == 0 {
+		o.Sources4 = []net.IP{SourceIPv4}
+	}
+	if len(o.Sources6) == 0 {
+		o.Sources6 = []net.IP{SourceIPv6}
+	}
+	o.Sources4 = o.Sources4[:min(len(o.Sources4), maxSources)]
+	o.Sources6 = o.Sources6[:min(len(o.Sources6), maxSources)]
+	if o.Families == 0 {
+		o.Families = FamilyAll
+	}
+	if o.ExpectedHops <= 0 {
+		o.ExpectedHops = 1
+	}
+	return o
+}
+
+// expectedTTL is the TTL of probes that passed the expected number of hops
+func (o TestOptions) expectedTTL() int32 {
+	return int32(probeTTL - o.ExpectedHops)
+}
+
+// sourcePort returns the source port of the next probe
+func (o TestOptions) sourcePort() int {
+	if o.RandomSourcePort {
+		return 1024 + rand.IntN(65536-1024)
+	}
+	if o.SourcePort > 0 {
+		return o.SourcePort
+	}
+	return o.port
+}
+
+// sources4 and sources6 return the source addresses of enabled address families
+// AllowedSources returns the source addresses o uses on any interface, including the defaults
+// if no source address is set
+func (o TestOptions) AllowedSources() []net.IP {
+	normalized := o.normalize()
+	sources := append(slices.Clone(normalized.Sources4), normalized.Sources6...)
+	for _, override := range o.Overrides {
+		sources = append(sources, override.Sources4...)
+		sources = append(sources, override.Sources6...)
+	}
+	return sources
+}
+
+func (o TestOptions) sources4() []net.IP {
+	if o.Families&FamilyIPv4 == 0 {
+		return nil
+	}
+	return o.Sources4
+}
+
+func (o TestOptions) sources6() []net.IP {
+	if o.Families&FamilyIPv6 == 0 {
+		return nil
+	}
+	return o.Sources6
+}
+
+// sources returns all source addresses of enabled address families, IPv4 first. The index of an
+// address in this list is embedded in the probe payload.
+func (o TestOptions) sources() []net.IP {
+	return append(slices.Clone(o.sources4()), o.sources6()...)
+}
+
 func DetectDstFromLoopBack(targetCIDR *net.IPNet) net.IP {
 	loopBack, err := net.InterfaceByName("lo")
 	if err != nil {
@@ -0,0 +1,60 @@
+package peerTester
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTestOptionsMerge(t *testing.T) {
+	base := TestOptions{
+		ProbeCount:       2,
+		ProbeInterval:    15 * time.Millisecond,
+		Timeout:          2 * time.Second,
+		Sources4:         []net.IP{net.ParseIP("172.20.0.53")},
+		Families:         FamilyAll,
+		RandomSourcePort: true,
+	}
+	tests := []struct {
+		name     string
+		override TestOptions
+		want     TestOptions
+	}{
+		{"empty override", TestOptions{}, base},
+		{"non-zero fields replace", TestOptions{
+			ProbeCount:   5,
+			Sources4:     []net.IP{net.ParseIP("172.20.0.54")},
+			Families:     FamilyIPv6,
+			Destination6: net.ParseIP("fd00::2"),
+			Peer:         &PeerInfo{Name: "alice"},
+			ExpectedHops: 2,
+		}, TestOptions{
+			ProbeCount:       5,
+			ProbeInterval:    15 * time.Millisecond,
+			Timeout:          2 * time.Second,
+			Sources4:         []net.IP{net.ParseIP("172.20.0.54")},
+			Families:         FamilyIPv6,
+			Destination6:     net.ParseIP("fd00::2"),
+			Peer:             &PeerInfo{Name: "alice"},
+			RandomSourcePort: true,
+			ExpectedHops:     2,
+		}},
+		{"empty sources are kept", TestOptions{Sources4: []net.IP{}, SourcePort: 4243}, TestOptions{
+			ProbeCount:       2,
+			ProbeInterval:    15 * time.Millisecond,
+			Timeout:          2 * time.Second,
+			Sources4:         []net.IP{net.ParseIP("172.20.0.53")},
+			Families:         FamilyAll,
+			RandomSourcePort: true,
+			SourcePort:       4243,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := base.Merge(tt.override); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Merge() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
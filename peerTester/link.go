@@ -0,0 +1,150 @@
+package peerTester
+
+import (
+	"fmt"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ARPHRD_* link types from /sys/class/net/<if>/type
+const (
+	arphrdEther   = 1
+	arphrdTunnel  = 768 // IPIP
+	arphrdTunnel6 = 769 // ip6tnl
+	arphrdSit     = 776
+	arphrdIpGre   = 778
+	arphrdIp6Gre  = 823
+	arphrdNone    = 65534 // tun, WireGuard
+)
+
+// linkTypeNames are the names accepted by InterfaceSelector.Types
+var linkTypeNames = map[string]int{
+	"ether":    arphrdEther,
+	"ipip":     arphrdTunnel,
+	"ip6tnl":   arphrdTunnel6,
+	"sit":      arphrdSit,
+	"gre":      arphrdIpGre,
+	"ip6gre":   arphrdIp6Gre,
+	"none":     arphrdNone,
+	"loopback": syscall.ARPHRD_LOOPBACK,
+}
+
+// linkFraming wraps IP packets into the frame format expected by the interface
+type linkFraming struct {
+	ifIndex  int
+	ethernet bool
+	srcMAC   net.HardwareAddr
+	dstMAC   net.HardwareAddr
+}
+
+func interfaceType(intFace *net.Interface) (int, error) {
+	intType, err := os.ReadFile("/sys/class/net/" + intFace.Name + "/type")
+	if err != nil {
+		return -1, fmt.Errorf("could not read type of %s: %s", intFace.Name, err)
+	}
+	return strconv.Atoi(strings.TrimSpace(string(intType)))
+}
+
+func newLinkFraming(intFace *net.Interface, opts TestOptions) (*linkFraming, error) {
+	hatype, err := interfaceType(intFace)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLinkType(intFace, hatype, opts); err != nil {
+		return nil, err
+	}
+	if hatype != arphrdEther {
+		return &linkFraming{ifIndex: intFace.Index}, nil
+	}
+
+	dstMAC := opts.PeerMAC
+	if dstMAC == nil {
+		dstMAC, err = resolvePeerMAC(intFace, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &linkFraming{
+		ifIndex:  intFace.Index,
+		ethernet: true,
+		srcMAC:   intFace.HardwareAddr,
+		dstMAC:   dstMAC,
+	}, nil
+}
+
+// checkLinkType returns an error if probes cannot be sent on an interface of the given link type
+// with the options for the interface
+func checkLinkType(intFace *net.Interface, hatype int, opts TestOptions) error {
+	switch hatype {
+	case arphrdNone, arphrdTunnel, arphrdTunnel6, arphrdSit:
+		return nil
+	case arphrdIpGre, arphrdIp6Gre:
+		// GRE devices without a fixed remote expect the outer headers to be supplied by the sender
+		if isNBMATunnel(intFace) {
+			return fmt.Errorf("%s is a GRE tunnel without a fixed remote address", intFace.Name)
+		}
+		return nil
+	case arphrdEther:
+		if len(intFace.HardwareAddr) != 6 {
+			return fmt.Errorf("%s has no ethernet address", intFace.Name)
+		}
+		if !hasKnownPeer(intFace, opts) {
+			return errUnknownPeer(intFace)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%s has unsupported link type %d", intFace.Name, hatype)
+	}
+}
+
+func (l *linkFraming) frame(packet []byte, isV4 bool) ([]byte, error) {
+	if !l.ethernet {
+		return packet, nil
+	}
+	ethernetType := layers.EthernetTypeIPv6
+	if isV4 {
+		ethernetType = layers.EthernetTypeIPv4
+	}
+	return buildEthernetFrame(l.dstMAC, l.srcMAC, ethernetType, packet)
+}
+
+// sockaddr returns the destination of a frame. The protocol is required by tunnel drivers such
+// as GRE, SIT and IPIP, which drop packets whose protocol does not match the carried IP version.
+func (l *linkFraming) sockaddr(isV4 bool) *syscall.SockaddrLinklayer {
+	protocol := uint16(layers.EthernetTypeIPv6)
+	if isV4 {
+		protocol = uint16(layers.EthernetTypeIPv4)
+	}
+	return &syscall.SockaddrLinklayer{
+		Protocol: htons(protocol),
+		Ifindex:  l.ifIndex,
+	}
+}
+
+// isNBMATunnel reports whether a tunnel has no fixed remote address, which the kernel
+// exposes as an all-zero broadcast address
+func isNBMATunnel(intFace *net.Interface) bool {
+	broadcast, err := os.ReadFile("/sys/class/net/" + intFace.Name + "/broadcast")
+	if err != nil {
+		return false
+	}
+	return strings.Trim(strings.TrimSpace(string(broadcast)), "0:") == ""
+}
+
+func buildEthernetFrame(dst, src net.HardwareAddr, ethernetType layers.EthernetType, data []byte) ([]byte, error) {
+	buffer := gopacket.NewSerializeBuffer()
+	eth := &layers.Ethernet{
+		SrcMAC:       src,
+		DstMAC:       dst,
+		EthernetType: ethernetType,
+	}
+	if err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{}, eth, gopacket.Payload(data)); err != nil {
+		return nil, fmt.Errorf("failed serialize frame: %s", err)
+	}
+	return buffer.Bytes(), nil
+}
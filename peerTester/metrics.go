@@ -0,0 +1,198 @@
+package peerTester
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Counters exported by the metrics handler
+var (
+	metricRuns         atomic.Uint64
+	metricTests        atomic.Uint64
+	metricSendErrors   atomic.Uint64
+	metricHmacRejected atomic.Uint64
+)
+
+// NewMetricsHandler returns an HTTP handler that exposes the results held by store in the
+// Prometheus text exposition format
+func NewMetricsHandler(store *ResultStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, store.States())
+	})
+}
+
+// ServeMetrics serves the metrics of store on /metrics at the given address
+func ServeMetrics(address string, store *ResultStore) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", NewMetricsHandler(store))
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return server.ListenAndServe()
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	samples []string
+}
+
+func (f *metricFamily) add(labels string, value float64) {
+	f.samples = append(f.samples, fmt.Sprintf("%s{%s} %g", f.name, labels, value))
+}
+
+// resultMetrics holds the metric families describing the outcome of a test
+type resultMetrics struct {
+	up     *metricFamily
+	status *metricFamily
+	rtt    *metricFamily
+	jitter *metricFamily
+	lost   *metricFamily
+}
+
+func (m *resultMetrics) families() []*metricFamily {
+	return []*metricFamily{m.up, m.status, m.rtt, m.jitter, m.lost}
+}
+
+// add adds the samples of r. Every status is exported, with 1 for the status of r and 0 for
+// all others. It returns false if r was not tested.
+func (m *resultMetrics) add(labels string, r *ListenResult) bool {
+	for result := OK; result <= PayloadTampered; result++ {
+		m.status.add(labels+",status=\""+result.String()+"\"", boolToFloat(r.Status == result))
+	}
+	if !r.Status.Tested() {
+		return false
+	}
+	m.up.add(labels, boolToFloat(r.Status == OK))
+	m.lost.add(labels, float64(r.PacketsLost))
+	if r.Stats != nil {
+		m.rtt.add(labels, r.Stats.Mean/1e6)
+		m.jitter.add(labels, r.Stats.Jitter/1e6)
+	}
+	return true
+}
+
+func writeMetrics(w io.Writer, states map[string]InterfaceState) {
+	var (
+		peer = &resultMetrics{
+			up:     &metricFamily{name: "peertester_peer_up", help: "Whether the last test of the address family succeeded", kind: "gauge"},
+			status: &metricFamily{name: "peertester_peer_status", help: "Status of the last test of the address family, 1 for the current status and 0 for all others", kind: "gauge"},
+			rtt:    &metricFamily{name: "peertester_rtt_seconds", help: "Mean round trip time of the last test", kind: "gauge"},
+			jitter: &metricFamily{name: "peertester_rtt_jitter_seconds", help: "Mean difference between the round trip times of consecutive probes", kind: "gauge"},
+			lost:   &metricFamily{name: "peertester_packets_lost", help: "Number of probes lost in the last test", kind: "gauge"},
+		}
+		source = &resultMetrics{
+			up:     &metricFamily{name: "peertester_source_up", help: "Whether the last test of the source address succeeded", kind: "gauge"},
+			status: &metricFamily{name: "peertester_source_status", help: "Status of the last test of the source address, 1 for the current status and 0 for all others", kind: "gauge"},
+			rtt:    &metricFamily{name: "peertester_source_rtt_seconds", help: "Mean round trip time of the last test of the source address", kind: "gauge"},
+			jitter: &metricFamily{name: "peertester_source_rtt_jitter_seconds", help: "Mean difference between the round trip times of consecutive probes of the source address", kind: "gauge"},
+			lost:   &metricFamily{name: "peertester_source_packets_lost", help: "Number of probes of the source address lost in the last test", kind: "gauge"},
+		}
+		ttl        = &metricFamily{name: "peertester_received_ttl", help: "TTL or hop limit of the last received probe", kind: "gauge"}
+		hops       = &metricFamily{name: "peertester_hops", help: "Number of routers the last received probe passed", kind: "gauge"}
+		pathMTU    = &metricFamily{name: "peertester_path_mtu_bytes", help: "Largest packet size that came back through the peer", kind: "gauge"}
+		lastTested = &metricFamily{name: "peertester_last_test_timestamp_seconds", help: "Time of the last test of the interface", kind: "gauge"}
+		lastChange = &metricFamily{name: "peertester_last_change_timestamp_seconds", help: "Time of the last status change of the interface", kind: "gauge"}
+	)
+
+	names := make([]string, 0, len(states))
+	for name := range states {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		state := states[name]
+		if state.Result == nil {
+			continue
+		}
+		intFaceLabel := "interface=\"" + escapeLabelValue(name) + "\""
+		lastTested.add(intFaceLabel, float64(state.LastTested.UnixMilli())/1000)
+		lastChange.add(intFaceLabel, float64(state.LastChange.UnixMilli())/1000)
+
+		for _, family := range []struct {
+			name   string
+			result *ListenResult
+		}{{"ipv4", state.Result.V4}, {"ipv6", state.Result.V6}} {
+			labels := intFaceLabel + ",family=\"" + family.name + "\""
+			r := family.result
+
+			if !peer.add(labels, r) {
+				continue
+			}
+			if r.TTL > 0 {
+				ttl.add(labels, float64(r.TTL))
+			}
+			if r.Hops >= 0 {
+				hops.add(labels, float64(r.Hops))
+			}
+			if r.PathMTU != nil && r.PathMTU.MTU >= 0 {
+				pathMTU.add(labels, float64(r.PathMTU.MTU))
+			}
+		}
+
+		sources := make([]string, 0, len(state.Result.BySource))
+		for address := range state.Result.BySource {
+			sources = append(sources, address)
+		}
+		slices.Sort(sources)
+		for _, address := range sources {
+			family := "ipv6"
+			if ip := net.ParseIP(address); ip != nil && ip.To4() != nil {
+				family = "ipv4"
+			}
+			source.add(intFaceLabel+",family=\""+family+"\",source=\""+escapeLabelValue(address)+"\"", state.Result.BySource[address])
+		}
+	}
+
+	families := append(peer.families(), ttl, hops, pathMTU)
+	families = append(families, source.families()...)
+	for _, f := range append(families, lastTested, lastChange) {
+		writeMetricFamily(w, f)
+	}
+
+	counters := []struct {
+		name  string
+		help  string
+		value uint64
+	}{
+		{"peertester_runs_total", "Number of test runs over a list of interfaces", metricRuns.Load()},
+		{"peertester_tests_total", "Number of interface tests", metricTests.Load()},
+		{"peertester_send_errors_total", "Number of interface tests that failed to send probes", metricSendErrors.Load()},
+		{"peertester_hmac_rejected_total", "Number of received packets rejected because of an invalid HMAC", metricHmacRejected.Load()},
+	}
+	for _, c := range counters {
+		_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", c.name, c.help, c.name, c.name, c.value)
+	}
+}
+
+func writeMetricFamily(w io.Writer, f *metricFamily) {
+	if len(f.samples) == 0 {
+		return
+	}
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+	for _, sample := range f.samples {
+		_, _ = fmt.Fprintln(w, sample)
+	}
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,174 @@
+package peerTester
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	ok := newListenResult(OK, "")
+	ok.PacketsLost = 1
+	ok.Stats = &LatencyStats{Mean: 1500, Jitter: 250}
+	ok.TTL = 64
+	ok.Hops = 0
+	ok.PathMTU = &PathMTU{MTU: 1420}
+	timeout := newListenResult(Timeout, "")
+	timeout.PacketsLost = 5
+	states := map[string]InterfaceState{
+		"wg\"0": {
+			Result: &IntFaceResult{
+				V4: ok,
+				V6: timeout,
+				BySource: map[string]*ListenResult{
+					"fd42::2":     timeout,
+					"172.20.0.53": ok,
+				},
+			},
+			LastTested: time.UnixMilli(1700000000500),
+			LastChange: time.UnixMilli(1700000000000),
+		},
+		"gre0": {
+			Result: &IntFaceResult{
+				V4: newListenResult(NotConfigured, ""),
+				V6: newListenResult(Disabled, ""),
+			},
+			LastTested: time.Unix(1700000010, 0),
+			LastChange: time.Unix(1700000010, 0),
+		},
+		"pending": {},
+	}
+	metricRuns.Store(2)
+	metricTests.Store(3)
+	metricSendErrors.Store(0)
+	metricHmacRejected.Store(1)
+
+	var b strings.Builder
+	writeMetrics(&b, states)
+	if b.String() != wantMetrics {
+		t.Errorf("writeMetrics() =\n%s\nwant\n%s", b.String(), wantMetrics)
+	}
+}
+
+const wantMetrics = `# HELP peertester_peer_up Whether the last test of the address family succeeded
+# TYPE peertester_peer_up gauge
+peertester_peer_up{interface="wg\"0",family="ipv4"} 1
+peertester_peer_up{interface="wg\"0",family="ipv6"} 0
+# HELP peertester_peer_status Status of the last test of the address family, 1 for the current status and 0 for all others
+# TYPE peertester_peer_status gauge
+peertester_peer_status{interface="gre0",family="ipv4",status="ok"} 0
+peertester_peer_status{interface="gre0",family="ipv4",status="timeout"} 0
+peertester_peer_status{interface="gre0",family="ipv4",status="invalid_ip"} 0
+peertester_peer_status{interface="gre0",family="ipv4",status="unexpected_ttl"} 0
+peertester_peer_status{interface="gre0",family="ipv4",status="disabled"} 0
+peertester_peer_status{interface="gre0",family="ipv4",status="not_configured"} 1
+peertester_peer_status{interface="gre0",family="ipv4",status="peer_no_route"} 0
+peertester_peer_status{interface="gre0",family="ipv4",status="peer_filtered"} 0
+peertester_peer_status{interface="gre0",family="ipv4",status="port_rewritten"} 0
+peertester_peer_status{interface="gre0",family="ipv4",status="payload_tampered"} 0
+peertester_peer_status{interface="gre0",family="ipv6",status="ok"} 0
+peertester_peer_status{interface="gre0",family="ipv6",status="timeout"} 0
+peertester_peer_status{interface="gre0",family="ipv6",status="invalid_ip"} 0
+peertester_peer_status{interface="gre0",family="ipv6",status="unexpected_ttl"} 0
+peertester_peer_status{interface="gre0",family="ipv6",status="disabled"} 1
+peertester_peer_status{interface="gre0",family="ipv6",status="not_configured"} 0
+peertester_peer_status{interface="gre0",family="ipv6",status="peer_no_route"} 0
+peertester_peer_status{interface="gre0",family="ipv6",status="peer_filtered"} 0
+peertester_peer_status{interface="gre0",family="ipv6",status="port_rewritten"} 0
+peertester_peer_status{interface="gre0",family="ipv6",status="payload_tampered"} 0
+peertester_peer_status{interface="wg\"0",family="ipv4",status="ok"} 1
+peertester_peer_status{interface="wg\"0",family="ipv4",status="timeout"} 0
+peertester_peer_status{interface="wg\"0",family="ipv4",status="invalid_ip"} 0
+peertester_peer_status{interface="wg\"0",family="ipv4",status="unexpected_ttl"} 0
+peertester_peer_status{interface="wg\"0",family="ipv4",status="disabled"} 0
+peertester_peer_status{interface="wg\"0",family="ipv4",status="not_configured"} 0
+peertester_peer_status{interface="wg\"0",family="ipv4",status="peer_no_route"} 0
+peertester_peer_status{interface="wg\"0",family="ipv4",status="peer_filtered"} 0
+peertester_peer_status{interface="wg\"0",family="ipv4",status="port_rewritten"} 0
+peertester_peer_status{interface="wg\"0",family="ipv4",status="payload_tampered"} 0
+peertester_peer_status{interface="wg\"0",family="ipv6",status="ok"} 0
+peertester_peer_status{interface="wg\"0",family="ipv6",status="timeout"} 1
+peertester_peer_status{interface="wg\"0",family="ipv6",status="invalid_ip"} 0
+peertester_peer_status{interface="wg\"0",family="ipv6",status="unexpected_ttl"} 0
+peertester_peer_status{interface="wg\"0",family="ipv6",status="disabled"} 0
+peertester_peer_status{interface="wg\"0",family="ipv6",status="not_configured"} 0
+peertester_peer_status{interface="wg\"0",family="ipv6",status="peer_no_route"} 0
+peertester_peer_status{interface="wg\"0",family="ipv6",status="peer_filtered"} 0
+peertester_peer_status{interface="wg\"0",family="ipv6",status="port_rewritten"} 0
+peertester_peer_status{interface="wg\"0",family="ipv6",status="payload_tampered"} 0
+# HELP peertester_rtt_seconds Mean round trip time of the last test
+# TYPE peertester_rtt_seconds gauge
+peertester_rtt_seconds{interface="wg\"0",family="ipv4"} 0.0015
+# HELP peertester_rtt_jitter_seconds Mean difference between the round trip times of consecutive probes
+# TYPE peertester_rtt_jitter_seconds gauge
+peertester_rtt_jitter_seconds{interface="wg\"0",family="ipv4"} 0.00025
+# HELP peertester_packets_lost Number of probes lost in the last test
+# TYPE peertester_packets_lost gauge
+peertester_packets_lost{interface="wg\"0",family="ipv4"} 1
+peertester_packets_lost{interface="wg\"0",family="ipv6"} 5
+# HELP peertester_received_ttl TTL or hop limit of the last received probe
+# TYPE peertester_received_ttl gauge
+peertester_received_ttl{interface="wg\"0",family="ipv4"} 64
+# HELP peertester_hops Number of routers the last received probe passed
+# TYPE peertester_hops gauge
+peertester_hops{interface="wg\"0",family="ipv4"} 0
+# HELP peertester_path_mtu_bytes Largest packet size that came back through the peer
+# TYPE peertester_path_mtu_bytes gauge
+peertester_path_mtu_bytes{interface="wg\"0",family="ipv4"} 1420
+# HELP peertester_source_up Whether the last test of the source address succeeded
+# TYPE peertester_source_up gauge
+peertester_source_up{interface="wg\"0",family="ipv4",source="172.20.0.53"} 1
+peertester_source_up{interface="wg\"0",family="ipv6",source="fd42::2"} 0
+# HELP peertester_source_status Status of the last test of the source address, 1 for the current status and 0 for all others
+# TYPE peertester_source_status gauge
+peertester_source_status{interface="wg\"0",family="ipv4",source="172.20.0.53",status="ok"} 1
+peertester_source_status{interface="wg\"0",family="ipv4",source="172.20.0.53",status="timeout"} 0
+peertester_source_status{interface="wg\"0",family="ipv4",source="172.20.0.53",status="invalid_ip"} 0
+peertester_source_status{interface="wg\"0",family="ipv4",source="172.20.0.53",status="unexpected_ttl"} 0
+peertester_source_status{interface="wg\"0",family="ipv4",source="172.20.0.53",status="disabled"} 0
+peertester_source_status{interface="wg\"0",family="ipv4",source="172.20.0.53",status="not_configured"} 0
+peertester_source_status{interface="wg\"0",family="ipv4",source="172.20.0.53",status="peer_no_route"} 0
+peertester_source_status{interface="wg\"0",family="ipv4",source="172.20.0.53",status="peer_filtered"} 0
+peertester_source_status{interface="wg\"0",family="ipv4",source="172.20.0.53",status="port_rewritten"} 0
+peertester_source_status{interface="wg\"0",family="ipv4",source="172.20.0.53",status="payload_tampered"} 0
+peertester_source_status{interface="wg\"0",family="ipv6",source="fd42::2",status="ok"} 0
+peertester_source_status{interface="wg\"0",family="ipv6",source="fd42::2",status="timeout"} 1
+peertester_source_status{interface="wg\"0",family="ipv6",source="fd42::2",status="invalid_ip"} 0
+peertester_source_status{interface="wg\"0",family="ipv6",source="fd42::2",status="unexpected_ttl"} 0
+peertester_source_status{interface="wg\"0",family="ipv6",source="fd42::2",status="disabled"} 0
+peertester_source_status{interface="wg\"0",family="ipv6",source="fd42::2",status="not_configured"} 0
+peertester_source_status{interface="wg\"0",family="ipv6",source="fd42::2",status="peer_no_route"} 0
+peertester_source_status{interface="wg\"0",family="ipv6",source="fd42::2",status="peer_filtered"} 0
+peertester_source_status{interface="wg\"0",family="ipv6",source="fd42::2",status="port_rewritten"} 0
+peertester_source_status{interface="wg\"0",family="ipv6",source="fd42::2",status="payload_tampered"} 0
+# HELP peertester_source_rtt_seconds Mean round trip time of the last test of the source address
+# TYPE peertester_source_rtt_seconds gauge
+peertester_source_rtt_seconds{interface="wg\"0",family="ipv4",source="172.20.0.53"} 0.0015
+# HELP peertester_source_rtt_jitter_seconds Mean difference between the round trip times of consecutive probes of the source address
+# TYPE peertester_source_rtt_jitter_seconds gauge
+peertester_source_rtt_jitter_seconds{interface="wg\"0",family="ipv4",source="172.20.0.53"} 0.00025
+# HELP peertester_source_packets_lost Number of probes of the source address lost in the last test
+# TYPE peertester_source_packets_lost gauge
+peertester_source_packets_lost{interface="wg\"0",family="ipv4",source="172.20.0.53"} 1
+peertester_source_packets_lost{interface="wg\"0",family="ipv6",source="fd42::2"} 5
+# HELP peertester_last_test_timestamp_seconds Time of the last test of the interface
+# TYPE peertester_last_test_timestamp_seconds gauge
+peertester_last_test_timestamp_seconds{interface="gre0"} 1.70000001e+09
+peertester_last_test_timestamp_seconds{interface="wg\"0"} 1.7000000005e+09
+# HELP peertester_last_change_timestamp_seconds Time of the last status change of the interface
+# TYPE peertester_last_change_timestamp_seconds gauge
+peertester_last_change_timestamp_seconds{interface="gre0"} 1.70000001e+09
+peertester_last_change_timestamp_seconds{interface="wg\"0"} 1.7e+09
+# HELP peertester_runs_total Number of test runs over a list of interfaces
+# TYPE peertester_runs_total counter
+peertester_runs_total 2
+# HELP peertester_tests_total Number of interface tests
+# TYPE peertester_tests_total counter
+peertester_tests_total 3
+# HELP peertester_send_errors_total Number of interface tests that failed to send probes
+# TYPE peertester_send_errors_total counter
+peertester_send_errors_total 0
+# HELP peertester_hmac_rejected_total Number of received packets rejected because of an invalid HMAC
+# TYPE peertester_hmac_rejected_total counter
+peertester_hmac_rejected_total 1
+`
@@ -0,0 +1,155 @@
+package peerTester
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+)
+
+// MonitorOptions controls how often interfaces are re-tested in monitor mode
+type MonitorOptions struct {
+	// Interval is the time between two tests of a healthy interface
+	Interval time.Duration
+	// Jitter is the maximum random delay added to every scheduled test
+	Jitter time.Duration
+	// RetryInterval is the delay before the first retest of a failing interface. It doubles with
+	// every consecutive failure up to Interval.
+	RetryInterval time.Duration
+}
+
+func DefaultMonitorOptions() MonitorOptions {
+	return MonitorOptions{
+		Interval:      time.Minute,
+		Jitter:        10 * time.Second,
+		RetryInterval: 10 * time.Second,
+	}
+}
+
+type Monitor struct {
+	tester *Tester
+	// names are the monitored interfaces. They are looked up again before every test, so that
+	// recreated tunnels are tested with their new index.
+	names    []string
+	selector *InterfaceSelector
+	dstIp    net.IP
+	dstIp6   net.IP
+	testOpts TestOptions
+	opts     MonitorOptions
+
+	// Store holds the last known state of every monitored interface
+	Store *ResultStore
+}
+
+// NewMonitor returns a monitor for intFaces. If selector is not nil, an interface is only tested
+// while it is still selected by it.
+func NewMonitor(tester *Tester, intFaces []net.Interface, selector *InterfaceSelector, dstIp, dstIp6 net.IP, testOpts TestOptions, opts MonitorOptions) *Monitor {
+	defaults := DefaultMonitorOptions()
+	if opts.Interval <= 0 {
+		opts.Interval = defaults.Interval
+	}
+	if opts.Jitter < 0 {
+		opts.Jitter = 0
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = min(defaults.RetryInterval, opts.Interval)
+	}
+	names := make([]string, 0, len(intFaces))
+	for _, intFace := range intFaces {
+		names = append(names, intFace.Name)
+	}
+	return &Monitor{
+		tester:   tester,
+		names:    names,
+		selector: selector,
+		dstIp:    dstIp,
+		dstIp6:   dstIp6,
+		testOpts: testOpts,
+		opts:     opts,
+		Store:    NewResultStore(),
+	}
+}
+
+// Run schedules tests for every interface until stop is closed
+func (m *Monitor) Run(stop <-chan struct{}) {
+	var semaphore = make(chan struct{}, max(Concurrency, 1))
+	var wg sync.WaitGroup
+	for _, name := range m.names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Spread the first round of tests over the first interval
+			delay := m.jitter(m.opts.Interval)
+			for {
+				timer := time.NewTimer(delay)
+				select {
+				case <-stop:
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+
+				select {
+				case <-stop:
+					return
+				case semaphore <- struct{}{}:
+				}
+				intFace, err := m.lookup(name)
+				if err != nil {
+					<-semaphore
+					if !OutputJSON {
+						fmt.Printf(" -- Warning: not testing %s: %s\n", name, err)
+					}
+					delay = m.opts.RetryInterval + m.jitter(m.opts.Jitter)
+					continue
+				}
+				r := m.tester.TestInterface(intFace, m.dstIp, m.dstIp6, m.testOpts)
+				<-semaphore
+
+				delay = m.nextDelay(m.Store.Record(name, r).ConsecutiveFailures)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// lookup returns the current state of the interface called name, and checks that it is still
+// selected
+func (m *Monitor) lookup(name string) (net.Interface, error) {
+	intFace, err := net.InterfaceByName(name)
+	if err != nil {
+		return net.Interface{}, err
+	}
+	if m.selector == nil {
+		return *intFace, nil
+	}
+	selector := *m.selector
+	selector.Options = m.testOpts
+	selected, _, err := selector.Select([]net.Interface{*intFace})
+	if err != nil {
+		return net.Interface{}, err
+	}
+	if len(selected) == 0 {
+		return net.Interface{}, fmt.Errorf("interface is no longer selected")
+	}
+	return selected[0], nil
+}
+
+func (m *Monitor) nextDelay(failures int) time.Duration {
+	if failures == 0 {
+		return m.opts.Interval + m.jitter(m.opts.Jitter)
+	}
+	backoff := m.opts.RetryInterval
+	for i := 1; i < failures && backoff < m.opts.Interval; i++ {
+		backoff *= 2
+	}
+	return min(backoff, m.opts.Interval) + m.jitter(m.opts.Jitter)
+}
+
+func (m *Monitor) jitter(limit time.Duration) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+	return rand.N(limit)
+}
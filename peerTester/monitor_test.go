@@ -0,0 +1,37 @@
+package peerTester
+
+import (
+	"net"
+	"testing"
+)
+
+func TestMonitorLookup(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skipf("no loopback interface: %s", err)
+	}
+	tests := []struct {
+		name     string
+		intFace  string
+		selector *InterfaceSelector
+		wantErr  bool
+	}{
+		{"no selector", "lo", nil, false},
+		{"still selected", "lo", &InterfaceSelector{Include: []string{"lo"}}, false},
+		{"no longer selected", "lo", &InterfaceSelector{Exclude: []string{"lo"}}, true},
+		{"wrong type", "lo", &InterfaceSelector{Types: []string{"gre"}}, true},
+		{"removed", "peertester-missing0", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMonitor(nil, []net.Interface{*lo}, tt.selector, nil, nil, TestOptions{}, MonitorOptions{})
+			intFace, err := m.lookup(tt.intFace)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("lookup() error = %v, want error %t", err, tt.wantErr)
+			}
+			if err == nil && intFace.Index != lo.Index {
+				t.Errorf("lookup() index = %d, want %d", intFace.Index, lo.Index)
+			}
+		})
+	}
+}
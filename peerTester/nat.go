@@ -0,0 +1,141 @@
+package peerTester
+
+import (
+	"net"
+	"strconv"
+	"time"
+)
+
+// NATKind is the kind of rewrite found on a received probe
+type NATKind string
+
+const (
+	// NATTunnelAddress is reported if the source address was replaced by one of the peer's
+	// addresses on the tunnel, as done by masquerading on the peer's router
+	NATTunnelAddress NATKind = "masquerade_tunnel"
+	// NATPublicAddress is reported if the source address was replaced by a public address
+	NATPublicAddress NATKind = "masquerade_public"
+	// NATOtherAddress is reported if the source address was replaced by any other address
+	NATOtherAddress NATKind = "masquerade_other"
+	// NATPortOnly is reported if only the source port was changed
+	NATPortOnly NATKind = "port_rewrite"
+	// NATPayload is reported if the payload or its length was changed
+	NATPayload NATKind = "payload_tampered"
+)
+
+// NATFinding describes how a probe was rewritten on its way back to the listener
+type NATFinding struct {
+	Kind NATKind
+	// ObservedAddress and ObservedPort are the source address and port the probe arrived with
+	ObservedAddress net.IP
+	ObservedPort    int
+	// ExpectedPort is the source port the probe was sent with, or 0 if unknown
+	ExpectedPort int
+}
+
+func (f *NATFinding) String() string {
+	switch f.Kind {
+	case NATTunnelAddress:
+		return "NAT to peer tunnel address " + f.ObservedAddress.String()
+	case NATPublicAddress:
+		return "NAT to public address " + f.ObservedAddress.String()
+	case NATPortOnly:
+		return "Source port rewritten to " + strconv.Itoa(f.ObservedPort)
+	case NATPayload:
+		return "Payload tampered"
+	default:
+		return "Invalid source IP: " + f.ObservedAddress.String()
+	}
+}
+
+// acceptTampered tells whether a probe with an invalid HMAC is reported as tampered. Its header is
+// not authenticated, so it must name a sent probe that has not been received yet, and arrive from
+// the address and port that probe was sent from. Other packets with an invalid HMAC are only
+// counted in the metrics.
+func acceptTampered(result *ListenResult, sent *timeInfo, source net.IP, received map[[2]uint8]time.Time) bool {
+	if sent == nil || !result.remoteIP.Equal(source) || result.remotePort != sent.srcPort {
+		return false
+	}
+	_, done := received[[2]uint8{sent.sourceIndex, sent.id}]
+	return !done
+}
+
+// peerAddresses holds the addresses the peer is known to use on an interface
+type peerAddresses struct {
+	addresses []net.IP
+	subnets   []*net.IPNet
+	own       []net.IP
+}
+
+// newPeerAddresses collects the peer's tunnel addresses from the options, point-to-point subnets,
+// the neighbour table and the BGP sessions of the interface. Addresses in the interface subnets
+// and in routes through the interface also count as the peer's.
+func newPeerAddresses(intFace *net.Interface, opts TestOptions, sessions []BGPSession) *peerAddresses {
+	p := &peerAddresses{addresses: peerAddressCandidates(intFace, opts)}
+	for _, session := range sessions {
+		if session.NeighborAddress != nil {
+			p.addresses = append(p.addresses, session.NeighborAddress)
+		}
+	}
+	if neighbors, err := readNeighborTable(intFace.Index); err == nil {
+		for _, neighbor := range neighbors {
+			p.addresses = append(p.addresses, neighbor.ip)
+		}
+	}
+
+	if addresses, err := intFace.Addrs(); err == nil {
+		for _, address := range addresses {
+			ipNet, ok := address.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			p.own = append(p.own, ipNet.IP)
+			if !ipNet.IP.IsLinkLocalUnicast() {
+				p.subnets = append(p.subnets, ipNet)
+			}
+		}
+	}
+	if routes, err := readUnicastRoutes(); err == nil {
+		for _, route := range routes {
+			// The default route covers every address and tells nothing about the peer
+			if route.ifIndex != intFace.Index || route.dst == nil {
+				continue
+			}
+			if ones, _ := route.dst.Mask.Size(); ones == 0 || route.dst.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			p.subnets = append(p.subnets, route.dst)
+		}
+	}
+	return p
+}
+
+func (p *peerAddresses) contains(ip net.IP) bool {
+	for _, address := range p.addresses {
+		if address.Equal(ip) {
+			return true
+		}
+	}
+	for _, own := range p.own {
+		if own.Equal(ip) {
+			return false
+		}
+	}
+	for _, subnet := range p.subnets {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyAddressNAT returns the kind of address rewrite that results in the observed address
+func classifyAddressNAT(observed net.IP, peer *peerAddresses) NATKind {
+	if peer != nil && peer.contains(observed) {
+		return NATTunnelAddress
+	}
+	if observed.IsGlobalUnicast() && !observed.IsPrivate() {
+		return NATPublicAddress
+	}
+	return NATOtherAddress
+}
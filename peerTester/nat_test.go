@@ -0,0 +1,115 @@
+package peerTester
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func testPeerAddresses() *peerAddresses {
+	_, subnet, _ := net.ParseCIDR("172.20.1.0/30")
+	return &peerAddresses{
+		addresses: []net.IP{net.ParseIP("fe80::ade0")},
+		subnets:   []*net.IPNet{subnet},
+		own:       []net.IP{net.ParseIP("172.20.1.1")},
+	}
+}
+
+func TestClassifyAddressNAT(t *testing.T) {
+	tests := []struct {
+		observed string
+		peer     *peerAddresses
+		want     NATKind
+	}{
+		{"fe80::ade0", testPeerAddresses(), NATTunnelAddress},
+		{"172.20.1.2", testPeerAddresses(), NATTunnelAddress},
+		{"172.20.1.1", testPeerAddresses(), NATOtherAddress},
+		{"172.20.2.1", testPeerAddresses(), NATOtherAddress},
+		{"192.0.2.1", nil, NATPublicAddress},
+		{"2001:db8::1", testPeerAddresses(), NATPublicAddress},
+		{"10.0.0.1", nil, NATOtherAddress},
+		{"fd42::1", nil, NATOtherAddress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.observed, func(t *testing.T) {
+			if got := classifyAddressNAT(net.ParseIP(tt.observed), tt.peer); got != tt.want {
+				t.Errorf("classifyAddressNAT() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateResult(t *testing.T) {
+	source := net.ParseIP("172.20.0.53")
+	tests := []struct {
+		name       string
+		remoteIP   string
+		remotePort int
+		tampered   bool
+		ttl        int32
+		// sourcePort is the port the probe was sent from, 0 if unknown
+		sourcePort int
+		want       testResult
+		wantNAT    NATKind
+		wantText   string
+	}{
+		{"intact", "172.20.0.53", 4242, false, 63, 4242, OK, "", "OK"},
+		{"unknown source port", "172.20.0.53", 4242, false, 63, 0, OK, "", "OK"},
+		{"unexpected TTL", "172.20.0.53", 4242, false, 61, 4242, UnexpectedTTL, "", "TTL value of 61"},
+		{"port rewritten", "172.20.0.53", 50000, false, 63, 4242, PortRewritten, NATPortOnly, "Source port rewritten to 50000"},
+		{"masquerade to the tunnel address", "172.20.1.2", 4242, false, 63, 4242, InvalidIP, NATTunnelAddress, "NAT to peer tunnel address 172.20.1.2"},
+		{"masquerade to a public address", "192.0.2.1", 50000, false, 63, 4242, InvalidIP, NATPublicAddress, "NAT to public address 192.0.2.1"},
+		{"other address", "10.0.0.1", 4242, false, 63, 4242, InvalidIP, NATOtherAddress, "Invalid source IP: 10.0.0.1"},
+		{"tampered", "172.20.0.53", 4242, true, 63, 4242, PayloadTampered, NATPayload, "Payload tampered"},
+		{"tampered with a random source port", "172.20.0.53", 61000, true, 63, 61000, PayloadTampered, NATPayload, "Payload tampered"},
+		{"port rewritten with a random source port", "172.20.0.53", 4242, false, 63, 61000, PortRewritten, NATPortOnly, "Source port rewritten to 4242"},
+		{"address and port rewritten", "172.20.1.2", 50000, false, 63, 4242, InvalidIP, NATTunnelAddress, "NAT to peer tunnel address 172.20.1.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &ListenResult{remoteIP: net.ParseIP(tt.remoteIP), remotePort: tt.remotePort, tampered: tt.tampered, TTL: tt.ttl, Hops: -1}
+			evaluateResult(result, source, tt.sourcePort, testPeerAddresses(), 63)
+			var gotNAT NATKind
+			if result.NAT != nil {
+				gotNAT = result.NAT.Kind
+			}
+			if result.Status != tt.want || gotNAT != tt.wantNAT || result.ErrorText != tt.wantText {
+				t.Errorf("evaluateResult() = %s, %q, %q, want %s, %q, %q", result.Status, gotNAT, result.ErrorText, tt.want, tt.wantNAT, tt.wantText)
+			}
+			if result.Hops != probeTTL-int(tt.ttl) {
+				t.Errorf("evaluateResult() hops = %d, want %d", result.Hops, probeTTL-int(tt.ttl))
+			}
+		})
+	}
+}
+
+func TestAcceptTampered(t *testing.T) {
+	source := net.ParseIP("172.20.0.53")
+	sent := &timeInfo{id: 3, sourceIndex: 1, srcPort: 4242}
+	tests := []struct {
+		name       string
+		remoteIP   string
+		remotePort int
+		sent       *timeInfo
+		received   bool
+		want       bool
+	}{
+		{"outstanding probe", "172.20.0.53", 4242, sent, false, true},
+		{"no sent probe", "172.20.0.53", 4242, nil, false, false},
+		{"already received", "172.20.0.53", 4242, sent, true, false},
+		{"other source address", "172.20.1.2", 4242, sent, false, false},
+		{"other source port", "172.20.0.53", 50000, sent, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := make(map[[2]uint8]time.Time)
+			if tt.received {
+				received[[2]uint8{1, 3}] = time.Now()
+			}
+			result := &ListenResult{remoteIP: net.ParseIP(tt.remoteIP), remotePort: tt.remotePort, tampered: true}
+			if got := acceptTampered(result, tt.sent, source, received); got != tt.want {
+				t.Errorf("acceptTampered() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
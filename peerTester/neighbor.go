@@ -0,0 +1,346 @@
+package peerTester
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"net"
+	"syscall"
+	"time"
+)
+
+// neighborResolveTimeout is the time to wait for ARP and NDP replies
+const neighborResolveTimeout = time.Second
+
+// Neighbour states from linux/neighbour.h
+const (
+	nudIncomplete = 0x01
+	nudFailed     = 0x20
+	nudNoArp      = 0x40
+
+	ndaDst    = 1
+	ndaLLAddr = 2
+
+	sizeofNdMsg = 12
+)
+
+type neighborEntry struct {
+	ifIndex int
+	state   uint16
+	ip      net.IP
+	mac     net.HardwareAddr
+}
+
+// resolvePeerMAC finds the link-layer address of the peer on an ethernet-like interface. The peer's
+// addresses are taken from the options or derived from point-to-point subnets on the interface.
+// The kernel neighbour table is consulted first, then ARP and NDP requests are sent on the link.
+func resolvePeerMAC(intFace *net.Interface, opts TestOptions) (net.HardwareAddr, error) {
+	candidates := peerAddressCandidates(intFace, opts)
+	if len(candidates) == 0 {
+		return nil, errUnknownPeer(intFace)
+	}
+
+	neighbors, err := readNeighborTable(intFace.Index)
+	if err == nil {
+		for _, candidate := range candidates {
+			for _, neighbor := range neighbors {
+				if neighbor.ip.Equal(candidate) {
+					return neighbor.mac, nil
+				}
+			}
+		}
+	}
+
+	for _, candidate := range candidates {
+		var mac net.HardwareAddr
+		if candidate.To4() != nil {
+			mac, err = arpResolve(intFace, candidate)
+		} else {
+			mac, err = ndpResolve(intFace, candidate)
+		}
+		if err == nil {
+			return mac, nil
+		}
+	}
+	return nil, fmt.Errorf("could not resolve the peer's link-layer address on %s", intFace.Name)
+}
+
+// hasKnownPeer tells whether the peer on an ethernet-like interface can be determined without
+// guessing, from the options or from a point-to-point subnet. Other hosts on a shared segment,
+// such as a gateway or containers on a bridge, are never taken for the peer.
+func hasKnownPeer(intFace *net.Interface, opts TestOptions) bool {
+	return opts.PeerMAC != nil || len(peerAddressCandidates(intFace, opts)) != 0
+}
+
+func errUnknownPeer(intFace *net.Interface) error {
+	return fmt.Errorf("%s is an ethernet link without a known peer, set neighbor4, neighbor6 or peer_mac", intFace.Name)
+}
+
+func peerAddressCandidates(intFace *net.Interface, opts TestOptions) []net.IP {
+	candidates := make([]net.IP, 0)
+	if opts.Neighbor4 != nil {
+		candidates = append(candidates, opts.Neighbor4)
+	}
+	if opts.Neighbor6 != nil {
+		candidates = append(candidates, opts.Neighbor6)
+	}
+
+	addresses, err := intFace.Addrs()
+	if err != nil {
+		return candidates
+	}
+	for _, addr := range addresses {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if peer := pointToPointPeer(ipNet); peer != nil {
+			candidates = append(candidates, peer)
+		}
+	}
+	return candidates
+}
+
+// pointToPointPeer returns the other host address of a /31, /30 or /127 subnet
+func pointToPointPeer(ipNet *net.IPNet) net.IP {
+	ones, bits := ipNet.Mask.Size()
+	ip := ipNet.IP
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	peer := make(net.IP, len(ip))
+	copy(peer, ip)
+	last := len(peer) - 1
+	switch {
+	case bits-ones == 1:
+		peer[last] ^= 1
+	case bits == 32 && ones == 30:
+		// Only the two middle addresses are usable host addresses
+		if peer[last]&3 == 1 {
+			peer[last]++
+		} else if peer[last]&3 == 2 {
+			peer[last]--
+		} else {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return peer
+}
+
+// readNeighborTable dumps the kernel neighbour table entries of an interface via netlink
+func readNeighborTable(ifIndex int) ([]neighborEntry, error) {
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETNEIGH, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, err
+	}
+
+	neighbors := make([]neighborEntry, 0)
+	for _, m := range messages {
+		if m.Header.Type != syscall.RTM_NEWNEIGH || len(m.Data) < sizeofNdMsg {
+			continue
+		}
+		entry := neighborEntry{
+			ifIndex: int(int32(binary.NativeEndian.Uint32(m.Data[4:8]))),
+			state:   binary.NativeEndian.Uint16(m.Data[8:10]),
+		}
+		if entry.ifIndex != ifIndex || entry.state&(nudIncomplete|nudFailed) != 0 {
+			continue
+		}
+
+		attributes := m.Data[sizeofNdMsg:]
+		for len(attributes) >= syscall.SizeofRtAttr {
+			attrLen := int(binary.NativeEndian.Uint16(attributes[0:2]))
+			attrType := binary.NativeEndian.Uint16(attributes[2:4])
+			if attrLen < syscall.SizeofRtAttr || attrLen > len(attributes) {
+				break
+			}
+			value := attributes[syscall.SizeofRtAttr:attrLen]
+			switch attrType {
+			case ndaDst:
+				entry.ip = net.IP(append([]byte(nil), value...))
+			case ndaLLAddr:
+				entry.mac = net.HardwareAddr(append([]byte(nil), value...))
+			}
+			attributes = attributes[min(rtaAlign(attrLen), len(attributes)):]
+		}
+		if entry.ip != nil && len(entry.mac) == 6 {
+			neighbors = append(neighbors, entry)
+		}
+	}
+	return neighbors, nil
+}
+
+func rtaAlign(length int) int {
+	return (length + syscall.RTA_ALIGNTO - 1) & ^(syscall.RTA_ALIGNTO - 1)
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
+
+// openEthernetProtocol opens an AF_PACKET socket on the interface receiving only the given ethertype
+func openEthernetProtocol(intFace *net.Interface, ethernetType uint16, timeout time.Duration) (int, error) {
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(ethernetType)))
+	if err != nil {
+		return -1, fmt.Errorf("failed open socket: %s", err)
+	}
+	err = syscall.Bind(fd, &syscall.SockaddrLinklayer{
+		Protocol: htons(ethernetType),
+		Ifindex:  intFace.Index,
+	})
+	if err != nil {
+		_ = syscall.Close(fd)
+		return -1, fmt.Errorf("could not bind socket to device: %s", err)
+	}
+	tv := syscall.NsecToTimeval(timeout.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		_ = syscall.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// exchangeFrames sends a frame and passes every received frame to match until it returns a
+// result or the timeout is reached
+func exchangeFrames(intFace *net.Interface, ethernetType uint16, request []byte, match func(gopacket.Packet) net.HardwareAddr) (net.HardwareAddr, error) {
+	fd, err := openEthernetProtocol(intFace, ethernetType, 100*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	defer func(fd int) {
+		_ = syscall.Close(fd)
+	}(fd)
+
+	if _, err := syscall.Write(fd, request); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(neighborResolveTimeout)
+	buf := make([]byte, 1500)
+	for time.Now().Before(deadline) {
+		n, err := syscall.Read(fd, buf)
+		if err != nil {
+			continue
+		}
+		packet := gopacket.NewPacket(buf[:n], layers.LayerTypeEthernet, gopacket.Default)
+		if mac := match(packet); mac != nil {
+			return mac, nil
+		}
+	}
+	return nil, fmt.Errorf("no reply")
+}
+
+func firstAddress(intFace *net.Interface, match func(net.IP) bool) net.IP {
+	addresses, err := intFace.Addrs()
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addresses {
+		if ipNet, ok := addr.(*net.IPNet); ok && match(ipNet.IP) {
+			return ipNet.IP
+		}
+	}
+	return nil
+}
+
+func arpResolve(intFace *net.Interface, target net.IP) (net.HardwareAddr, error) {
+	src := firstAddress(intFace, func(ip net.IP) bool { return ip.To4() != nil })
+	if src == nil {
+		return nil, fmt.Errorf("%s has no IPv4 address", intFace.Name)
+	}
+
+	buffer := gopacket.NewSerializeBuffer()
+	eth := &layers.Ethernet{
+		SrcMAC:       intFace.HardwareAddr,
+		DstMAC:       layers.EthernetBroadcast,
+		EthernetType: layers.EthernetTypeARP,
+	}
+	arp := &layers.ARP{
+		AddrType:          layers.LinkTypeEthernet,
+		Protocol:          layers.EthernetTypeIPv4,
+		HwAddressSize:     6,
+		ProtAddressSize:   4,
+		Operation:         layers.ARPRequest,
+		SourceHwAddress:   intFace.HardwareAddr,
+		SourceProtAddress: src.To4(),
+		DstHwAddress:      make([]byte, 6),
+		DstProtAddress:    target.To4(),
+	}
+	if err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{}, eth, arp); err != nil {
+		return nil, fmt.Errorf("failed serialize packet: %s", err)
+	}
+
+	return exchangeFrames(intFace, uint16(layers.EthernetTypeARP), buffer.Bytes(), func(packet gopacket.Packet) net.HardwareAddr {
+		reply, ok := packet.Layer(layers.LayerTypeARP).(*layers.ARP)
+		if !ok || reply.Operation != layers.ARPReply || !net.IP(reply.SourceProtAddress).Equal(target) {
+			return nil
+		}
+		return net.HardwareAddr(reply.SourceHwAddress)
+	})
+}
+
+func ndpResolve(intFace *net.Interface, target net.IP) (net.HardwareAddr, error) {
+	src := firstAddress(intFace, func(ip net.IP) bool { return ip.To4() == nil && ip.IsLinkLocalUnicast() })
+	if src == nil {
+		src = firstAddress(intFace, func(ip net.IP) bool { return ip.To4() == nil })
+	}
+	if src == nil {
+		return nil, fmt.Errorf("%s has no IPv6 address", intFace.Name)
+	}
+
+	target = target.To16()
+	solicitedNode := net.IP{0xff, 0x02, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0xff, target[13], target[14], target[15]}
+	multicastMAC := net.HardwareAddr{0x33, 0x33, 0xff, target[13], target[14], target[15]}
+
+	buffer := gopacket.NewSerializeBuffer()
+	eth := &layers.Ethernet{
+		SrcMAC:       intFace.HardwareAddr,
+		DstMAC:       multicastMAC,
+		EthernetType: layers.EthernetTypeIPv6,
+	}
+	ip := &layers.IPv6{
+		Version:    6,
+		SrcIP:      src,
+		DstIP:      solicitedNode,
+		HopLimit:   255,
+		NextHeader: layers.IPProtocolICMPv6,
+	}
+	icmp := &layers.ICMPv6{
+		TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeNeighborSolicitation, 0),
+	}
+	if err := icmp.SetNetworkLayerForChecksum(ip); err != nil {
+		return nil, fmt.Errorf("failed calc checksum: %s", err)
+	}
+	solicitation := &layers.ICMPv6NeighborSolicitation{
+		TargetAddress: target,
+		Options: layers.ICMPv6Options{
+			{Type: layers.ICMPv6OptSourceAddress, Data: intFace.HardwareAddr},
+		},
+	}
+	if err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{ComputeChecksums: true, FixLengths: true}, eth, ip, icmp, solicitation); err != nil {
+		return nil, fmt.Errorf("failed serialize packet: %s", err)
+	}
+
+	return exchangeFrames(intFace, uint16(layers.EthernetTypeIPv6), buffer.Bytes(), func(packet gopacket.Packet) net.HardwareAddr {
+		advertisement, ok := packet.Layer(layers.LayerTypeICMPv6NeighborAdvertisement).(*layers.ICMPv6NeighborAdvertisement)
+		if !ok || !advertisement.TargetAddress.Equal(target) {
+			return nil
+		}
+		for _, option := range advertisement.Options {
+			if option.Type == layers.ICMPv6OptTargetAddress && len(option.Data) == 6 {
+				return net.HardwareAddr(option.Data)
+			}
+		}
+		if eth, ok := packet.Layer(layers.LayerTypeEthernet).(*layers.Ethernet); ok {
+			return eth.SrcMAC
+		}
+		return nil
+	})
+}
@@ -0,0 +1,55 @@
+package peerTester
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPointToPointPeer(t *testing.T) {
+	tests := []struct {
+		cidr string
+		// want is the peer address, empty if there is none
+		want string
+	}{
+		{"172.20.0.0/31", "172.20.0.1"},
+		{"172.20.0.1/31", "172.20.0.0"},
+		{"172.20.0.1/30", "172.20.0.2"},
+		{"172.20.0.2/30", "172.20.0.1"},
+		{"172.20.0.0/30", ""},
+		{"172.20.0.3/30", ""},
+		{"172.20.0.1/29", ""},
+		{"172.20.0.1/32", ""},
+		{"fd00::a/127", "fd00::b"},
+		{"fd00::b/127", "fd00::a"},
+		{"fd00::1/126", ""},
+		{"fe80::1/64", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cidr, func(t *testing.T) {
+			ip, ipNet, err := net.ParseCIDR(tt.cidr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Interface addresses hold the host address, not the network address
+			ipNet.IP = ip
+			var got string
+			if peer := pointToPointPeer(ipNet); peer != nil {
+				got = peer.String()
+			}
+			if got != tt.want {
+				t.Errorf("pointToPointPeer() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolvePeerMACWithoutPeer(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skipf("no loopback interface: %s", err)
+	}
+	// lo has no point-to-point subnet, so without a configured neighbour nothing is guessed
+	if _, err := resolvePeerMAC(lo, TestOptions{}); err == nil {
+		t.Errorf("resolvePeerMAC() without a known peer succeeded")
+	}
+}
@@ -7,16 +7,36 @@ import (
 	"net"
 )
 
-func buildUDPPacket(dst, src *net.UDPAddr, data []byte) ([]byte, error) {
+// probeTTL is the TTL and hop limit of the probes
+const probeTTL = 64
+
+// ipOptions are the IP header fields that differ between probes
+type ipOptions struct {
+	ttl uint8
+	// id is sent as IPv4 identification or IPv6 flow label, so that ICMP errors quoting the
+	// probe can be assigned to the test that sent it
+	id uint16
+	// tos is the IPv4 TOS or IPv6 traffic class, holding the DSCP and ECN bits
+	tos uint8
+	// dontFragment sets the IPv4 Don't Fragment bit. IPv6 packets are never fragmented on the way.
+	dontFragment bool
+}
+
+func buildUDPPacket(dst, src *net.UDPAddr, data []byte, options ipOptions) ([]byte, error) {
 	buffer := gopacket.NewSerializeBuffer()
 	payload := gopacket.Payload(data)
 	ip := &layers.IPv4{
 		DstIP:    dst.IP,
 		SrcIP:    src.IP,
 		Version:  4,
-		TTL:      64,
+		TTL:      options.ttl,
+		TOS:      options.tos,
+		Id:       options.id,
 		Protocol: layers.IPProtocolUDP,
 	}
+	if options.dontFragment {
+		ip.Flags = layers.IPv4DontFragment
+	}
 	udp := &layers.UDP{
 		SrcPort: layers.UDPPort(src.Port),
 		DstPort: layers.UDPPort(dst.Port),
@@ -30,15 +50,17 @@ func buildUDPPacket(dst, src *net.UDPAddr, data []byte) ([]byte, error) {
 	return buffer.Bytes(), nil
 }
 
-func buildUDPPacket6(dst, src *net.UDPAddr, data []byte) ([]byte, error) {
+func buildUDPPacket6(dst, src *net.UDPAddr, data []byte, options ipOptions) ([]byte, error) {
 	buffer := gopacket.NewSerializeBuffer()
 	payload := gopacket.Payload(data)
 	ip := &layers.IPv6{
-		DstIP:      dst.IP,
-		SrcIP:      src.IP,
-		Version:    6,
-		HopLimit:   64,
-		NextHeader: layers.IPProtocolUDP,
+		DstIP:        dst.IP,
+		SrcIP:        src.IP,
+		Version:      6,
+		HopLimit:     options.ttl,
+		TrafficClass: options.tos,
+		FlowLabel:    uint32(options.id),
+		NextHeader:   layers.IPProtocolUDP,
 	}
 	udp := &layers.UDP{
 		SrcPort: layers.UDPPort(src.Port),
@@ -0,0 +1,232 @@
+package peerTester
+
+import (
+	"crypto/sha256"
+	"net"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// minPathMTU is the smallest packet size tested, the minimum MTU of IPv6
+	minPathMTU = 1280
+	// maxPathMTU limits the search on interfaces with a very large MTU
+	maxPathMTU = 9000
+	// pathMTUAttempts is the number of probes sent for every packet size
+	pathMTUAttempts = 2
+)
+
+// PathMTU is the result of a path MTU test through the peer
+type PathMTU struct {
+	// MTU is the largest packet size in bytes that came back through the peer, or -1 if no
+	// probe came back
+	MTU int
+	// InterfaceMTU is the MTU of the interface, which is the largest size tested
+	InterfaceMTU int
+	// TooBig holds the ICMP Fragmentation Needed and ICMPv6 Packet Too Big messages received
+	TooBig []PacketTooBig
+}
+
+// PacketTooBig is an ICMP Fragmentation Needed or ICMPv6 Packet Too Big message
+type PacketTooBig struct {
+	Sender net.IP
+	// Size is the size of the rejected probe
+	Size int
+	// MTU is the next-hop MTU reported by the router, or 0 if it did not report one
+	MTU int
+}
+
+// measurePathMTUs runs a path MTU test for every address family whose probes came back
+func (t *Tester) measurePathMTUs(intFace net.Interface, r *IntFaceResult, dstIp net.IP, dstIp6 net.IP, opts TestOptions) {
+	if opts.Destination4 != nil {
+		dstIp = opts.Destination4
+	}
+	if opts.Destination6 != nil {
+		dstIp6 = opts.Destination6
+	}
+
+	var wg sync.WaitGroup
+	for _, family := range []struct {
+		result  *ListenResult
+		sources []net.IP
+		dst     net.IP
+	}{{r.V4, opts.sources4(), dstIp}, {r.V6, opts.sources6(), dstIp6}} {
+		if len(family.sources) == 0 || family.dst == nil || family.result.LatencyUs < 0 {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			family.result.PathMTU = t.measurePathMTU(intFace, family.sources[0], family.dst, opts)
+		}()
+	}
+	wg.Wait()
+}
+
+// measurePathMTU finds the largest probe that comes back through the peer. Probes are sent with
+// the Don't Fragment bit.
+func (t *Tester) measurePathMTU(intFace net.Interface, source net.IP, dst net.IP, opts TestOptions) *PathMTU {
+	counter, c := t.dispatcher.register(4 * pathMTUAttempts)
+	defer t.dispatcher.unregister(counter)
+
+	link, err := newLinkFraming(&intFace, opts)
+	if err != nil {
+		return nil
+	}
+	conn, err := open(&intFace)
+	if err != nil {
+		return nil
+	}
+	defer func(fd int) {
+		_ = syscall.Close(fd)
+	}(conn)
+
+	p := &pathMTUProber{conn: conn, link: link, source: source, dst: dst, counter: counter, results: c, opts: opts}
+	result := &PathMTU{MTU: -1, InterfaceMTU: intFace.MTU}
+
+	low, high := min(minPathMTU, intFace.MTU), min(intFace.MTU, maxPathMTU)
+	if low <= p.headerSize()+8+4+sha256.Size {
+		return result
+	}
+	result.MTU, result.TooBig = searchPathMTU(low, high, p.probe)
+	return result
+}
+
+// searchPathMTU binary-searches the largest size between low and high for which probe reports a
+// reply. The next-hop MTU of Fragmentation Needed and Packet Too Big messages is tried next and
+// narrows the search. It returns -1 if probes of size low do not come back either.
+func searchPathMTU(low, high int, probe func(size int) (bool, []PacketTooBig, error)) (int, []PacketTooBig) {
+	passed, allTooBig, err := probe(low)
+	if err != nil || !passed {
+		return -1, allTooBig
+	}
+	mtu := low
+
+	// The interface MTU is tried first, as most paths are not limited further
+	size := high
+	for low < high {
+		passed, tooBig, err := probe(size)
+		if err != nil {
+			break
+		}
+		allTooBig = append(allTooBig, tooBig...)
+		reported := false
+		if passed {
+			low = size
+			mtu = size
+		} else {
+			high = size - 1
+			// Routers report the MTU of the link the probe did not fit through
+			for _, message := range tooBig {
+				if message.MTU > low && message.MTU <= high {
+					high = message.MTU
+					reported = true
+				}
+			}
+		}
+		size = (low + high + 1) / 2
+		if reported {
+			size = high
+		}
+	}
+	return mtu, allTooBig
+}
+
+// pathMTUProber sends the probes of a path MTU test
+type pathMTUProber struct {
+	conn     int
+	link     *linkFraming
+	source   net.IP
+	dst      net.IP
+	counter  uint16
+	results  chan *ListenResult
+	opts     TestOptions
+	sequence uint8
+}
+
+func (p *pathMTUProber) isV4() bool {
+	return p.source.To4() != nil
+}
+
+// headerSize returns the size of the IP header of the probes
+func (p *pathMTUProber) headerSize() int {
+	if p.isV4() {
+		return 20
+	}
+	return 40
+}
+
+// probe sends probes of the given size and reports whether one of them came back, together with
+// the Fragmentation Needed and Packet Too Big messages received for them
+func (p *pathMTUProber) probe(size int) (bool, []PacketTooBig, error) {
+	p.sequence++
+	contents := make([]byte, size-p.headerSize()-8-sha256.Size)
+	contents[0] = byte(p.counter >> 8)
+	contents[1] = byte(p.counter)
+	contents[3] = p.sequence
+	toSend := hmacSeal([16]byte(hmacKey), contents)
+
+	src := &net.UDPAddr{IP: p.source, Port: p.opts.sourcePort()}
+	ip := ipOptions{ttl: probeTTL, id: p.counter, dontFragment: true}
+	var b []byte
+	var err error
+	if p.isV4() {
+		b, err = buildUDPPacket(&net.UDPAddr{IP: p.dst, Port: p.opts.port}, src, toSend, ip)
+	} else {
+		b, err = buildUDPPacket6(&net.UDPAddr{IP: p.dst, Port: p.opts.port}, src, toSend, ip)
+	}
+	if err != nil {
+		return false, nil, err
+	}
+	b, err = p.link.frame(b, p.isV4())
+	if err != nil {
+		return false, nil, err
+	}
+
+	for i := 0; i < pathMTUAttempts; i++ {
+		if err := syscall.Sendto(p.conn, b, 0, p.link.sockaddr(p.isV4())); err != nil {
+			return false, nil, err
+		}
+		if i != pathMTUAttempts-1 {
+			time.Sleep(p.opts.ProbeInterval)
+		}
+	}
+
+	passed, tooBig := awaitPathMTUProbe(p.results, p.sequence, size, time.After(p.opts.Timeout))
+	return passed, tooBig, nil
+}
+
+// awaitPathMTUProbe waits for a reply to the probes of the given sequence number and size. It
+// gives up once every attempt was answered with Fragmentation Needed or Packet Too Big, or at the
+// timeout.
+func awaitPathMTUProbe(results <-chan *ListenResult, sequence uint8, size int, timeout <-chan time.Time) (bool, []PacketTooBig) {
+	tooBig := make([]PacketTooBig, 0)
+	tooBigCount := 0
+	for {
+		select {
+		case result := <-results:
+			if result.icmp == nil {
+				// Replies to earlier, smaller probes may still arrive
+				if result.receiveTime.id == sequence && !result.tampered {
+					return true, tooBig
+				}
+				continue
+			}
+			if !result.icmp.tooBig(result.isV4) || result.icmp.size != size {
+				continue
+			}
+			// Every attempt is answered by the same router, which is recorded once
+			message := PacketTooBig{Sender: result.icmp.from, Size: size, MTU: result.icmp.mtu}
+			if !slices.ContainsFunc(tooBig, func(m PacketTooBig) bool { return m.Sender.Equal(message.Sender) && m.MTU == message.MTU }) {
+				tooBig = append(tooBig, message)
+			}
+			if tooBigCount++; tooBigCount == pathMTUAttempts {
+				return false, tooBig
+			}
+		case <-timeout:
+			return false, tooBig
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package peerTester
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSearchPathMTU(t *testing.T) {
+	router := net.ParseIP("172.20.1.1")
+	tests := []struct {
+		name string
+		// pathMTU is the largest size that passes, 0 if nothing passes
+		pathMTU int
+		// reportedMTU is the next-hop MTU of the Packet Too Big messages, none are sent if 0
+		reportedMTU int
+		// failAt is the size whose probe fails to send, if any
+		failAt    int
+		wantMTU   int
+		wantSizes []int
+	}{
+		{"unlimited", 1500, 0, 0, 1500, []int{1280, 1500}},
+		{"reported MTU", 1420, 1420, 0, 1420, []int{1280, 1500, 1420}},
+		{"reported MTU too large", 1420, 1600, 0, 1420, []int{1280, 1500, 1390, 1445, 1417, 1431, 1424, 1420, 1422, 1421}},
+		{"no report", 1420, 0, 0, 1420, []int{1280, 1500, 1390, 1445, 1417, 1431, 1424, 1420, 1422, 1421}},
+		{"unreachable", 0, 0, 0, -1, []int{1280}},
+		{"send error", 1420, 0, 1390, 1280, []int{1280, 1500, 1390}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sizes := make([]int, 0)
+			probe := func(size int) (bool, []PacketTooBig, error) {
+				sizes = append(sizes, size)
+				if size == tt.failAt {
+					return false, nil, errors.New("send failed")
+				}
+				if size <= tt.pathMTU {
+					return true, []PacketTooBig{}, nil
+				}
+				if tt.reportedMTU == 0 || tt.pathMTU == 0 {
+					return false, []PacketTooBig{}, nil
+				}
+				return false, []PacketTooBig{{Sender: router, Size: size, MTU: tt.reportedMTU}}, nil
+			}
+			mtu, _ := searchPathMTU(1280, 1500, probe)
+			if mtu != tt.wantMTU || !reflect.DeepEqual(sizes, tt.wantSizes) {
+				t.Errorf("searchPathMTU() = %d after %v, want %d after %v", mtu, sizes, tt.wantMTU, tt.wantSizes)
+			}
+		})
+	}
+}
+
+func TestAwaitPathMTUProbe(t *testing.T) {
+	const sequence, size = 3, 1500
+	reply := func(id uint8) *ListenResult {
+		return &ListenResult{receiveTime: timeInfo{id: id}, isV4: true}
+	}
+	tooBig := func(from string, probeSize, mtu int) *ListenResult {
+		return &ListenResult{isV4: true, icmp: &icmpMessage{
+			icmpType: icmpDestinationUnreachable,
+			code:     icmpFragmentationNeeded,
+			from:     net.ParseIP(from),
+			size:     probeSize,
+			mtu:      mtu,
+		}}
+	}
+	tampered := reply(sequence)
+	tampered.tampered = true
+	tests := []struct {
+		name       string
+		results    []*ListenResult
+		want       bool
+		wantTooBig int
+	}{
+		{"reply", []*ListenResult{reply(sequence)}, true, 0},
+		{"reply to an earlier probe", []*ListenResult{reply(sequence - 1)}, false, 0},
+		{"reply after an earlier one", []*ListenResult{reply(sequence - 1), reply(sequence)}, true, 0},
+		{"tampered reply", []*ListenResult{tampered}, false, 0},
+		{"too big for every attempt", []*ListenResult{tooBig("172.20.1.1", size, 1420), tooBig("172.20.1.1", size, 1420), reply(sequence)}, false, 1},
+		{"too big from two routers", []*ListenResult{tooBig("172.20.1.1", size, 1420), tooBig("172.20.1.2", size, 1400)}, false, 2},
+		{"too big for another size", []*ListenResult{tooBig("172.20.1.1", 1280, 1200), reply(sequence)}, true, 0},
+		{"single too big", []*ListenResult{tooBig("172.20.1.1", size, 1420)}, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := make(chan *ListenResult, len(tt.results))
+			for _, result := range tt.results {
+				results <- result
+			}
+			passed, messages := awaitPathMTUProbe(results, sequence, size, time.After(50*time.Millisecond))
+			if passed != tt.want || len(messages) != tt.wantTooBig {
+				t.Errorf("awaitPathMTUProbe() = %t, %d messages, want %t, %d messages", passed, len(messages), tt.want, tt.wantTooBig)
+			}
+		})
+	}
+}
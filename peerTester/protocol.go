@@ -0,0 +1,152 @@
+package peerTester
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ProtocolVersion is the version of the daemon request/response protocol
+const ProtocolVersion = 1
+
+// Error codes of the daemon protocol
+const (
+	ErrorInvalidRequest     = "invalid_request"
+	ErrorUnsupportedVersion = "unsupported_version"
+	ErrorUnknownInterface   = "unknown_interface"
+	ErrorInvalidOption      = "invalid_option"
+	ErrorListen             = "listen_failed"
+)
+
+// Request asks the daemon to test a set of interfaces. Options that are not set keep the
+// values given on the daemon command line and in its configuration file.
+type Request struct {
+	Version int    `json:"version"`
+	ID      string `json:"id,omitempty"`
+	// Interfaces holds interface names, glob patterns, regular expressions enclosed in slashes
+	// and exclusions prefixed with "!". An empty list selects the interfaces the daemon tests by default.
+	Interfaces   []string `json:"interfaces,omitempty"`
+	Families     []string `json:"families,omitempty"`
+	ProbeCount   int      `json:"probe_count,omitempty"`
+	Timeout      Duration `json:"timeout,omitempty"`
+	ExpectedHops int      `json:"expected_hops,omitempty"`
+	Traceroute   bool     `json:"traceroute,omitempty"`
+	PathMTU      bool     `json:"path_mtu,omitempty"`
+	DSCP         int      `json:"dscp,omitempty"`
+	ECN          int      `json:"ecn,omitempty"`
+	Src4         []string `json:"src4,omitempty"`
+	Src6         []string `json:"src6,omitempty"`
+	Dst4         string   `json:"dst4,omitempty"`
+	Dst6         string   `json:"dst6,omitempty"`
+}
+
+// Response answers a Request. Interfaces that could be tested are present in Results even if
+// other parts of the request failed.
+type Response struct {
+	Version int                       `json:"version"`
+	ID      string                    `json:"id,omitempty"`
+	Results map[string]*IntFaceResult `json:"results,omitempty"`
+	Errors  []ProtocolError           `json:"errors,omitempty"`
+}
+
+// ProtocolError describes why a request or the test of a single interface failed
+type ProtocolError struct {
+	Code      string `json:"code"`
+	Interface string `json:"interface,omitempty"`
+	Message   string `json:"message"`
+}
+
+func (e ProtocolError) Error() string {
+	if e.Interface != "" {
+		return fmt.Sprintf("%s: %s: %s", e.Code, e.Interface, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// NewResponse returns an empty response to the request
+func NewResponse(request *Request) *Response {
+	return &Response{
+		Version: ProtocolVersion,
+		ID:      request.ID,
+		Errors:  make([]ProtocolError, 0),
+	}
+}
+
+// AddError records an error in the response
+func (r *Response) AddError(code, intFace, message string) {
+	r.Errors = append(r.Errors, ProtocolError{Code: code, Interface: intFace, Message: message})
+}
+
+// Validate checks the version of the request
+func (r *Request) Validate() *ProtocolError {
+	if r.Version != ProtocolVersion {
+		return &ProtocolError{
+			Code:    ErrorUnsupportedVersion,
+			Message: fmt.Sprintf("version %d is not supported, use version %d", r.Version, ProtocolVersion),
+		}
+	}
+	return nil
+}
+
+// SelectInterfaces returns the interfaces matching the requested names and patterns, and an
+// error for every entry that matches no interface. Entries prefixed with "!" are exclusions.
+func (r *Request) SelectInterfaces(intFaces []net.Interface) ([]net.Interface, []ProtocolError) {
+	selector := &InterfaceSelector{}
+	for _, pattern := range r.Interfaces {
+		if excluded, ok := strings.CutPrefix(pattern, "!"); ok {
+			selector.Exclude = append(selector.Exclude, excluded)
+		} else {
+			selector.Include = append(selector.Include, pattern)
+		}
+	}
+	selected, unmatched, err := selector.Select(intFaces)
+	if err != nil {
+		return nil, []ProtocolError{{Code: ErrorInvalidRequest, Message: err.Error()}}
+	}
+	errs := make([]ProtocolError, 0, len(unmatched))
+	for _, pattern := range unmatched {
+		errs = append(errs, ProtocolError{Code: ErrorUnknownInterface, Interface: pattern, Message: "no matching interface"})
+	}
+	return selected, errs
+}
+
+// TestOptions returns the options set by the request
+func (r *Request) TestOptions() (TestOptions, error) {
+	peer := PeerConfig{
+		Families:     r.Families,
+		ProbeCount:   r.ProbeCount,
+		Timeout:      r.Timeout,
+		ExpectedHops: r.ExpectedHops,
+		Traceroute:   r.Traceroute,
+		PathMTU:      r.PathMTU,
+		DSCP:         r.DSCP,
+		ECN:          r.ECN,
+		Src4:         r.Src4,
+		Src6:         r.Src6,
+		Dst4:         r.Dst4,
+		Dst6:         r.Dst6,
+	}
+	if r.ProbeCount < 0 {
+		return TestOptions{}, fmt.Errorf("negative probe count")
+	}
+	if r.Timeout < 0 {
+		return TestOptions{}, fmt.Errorf("negative timeout")
+	}
+	if r.ExpectedHops < 0 {
+		return TestOptions{}, fmt.Errorf("negative expected hop count")
+	}
+	return peer.testOptions()
+}
+
+// WithOverride applies override on top of the options of every given interface
+func (o TestOptions) WithOverride(intFaces []net.Interface, override TestOptions) TestOptions {
+	overrides := make(map[string]TestOptions, len(o.Overrides)+len(intFaces))
+	for name, existing := range o.Overrides {
+		overrides[name] = existing
+	}
+	for _, intFace := range intFaces {
+		overrides[intFace.Name] = overrides[intFace.Name].Merge(override)
+	}
+	o.Overrides = overrides
+	return o
+}
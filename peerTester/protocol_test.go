@@ -0,0 +1,139 @@
+package peerTester
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRequestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		wantErr string
+	}{
+		{"current version", `{"version": 1, "id": "a"}`, ""},
+		{"missing version", `{"id": "a"}`, ErrorUnsupportedVersion},
+		{"future version", `{"version": 2}`, ErrorUnsupportedVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := &Request{}
+			if err := json.Unmarshal([]byte(tt.line), request); err != nil {
+				t.Fatal(err)
+			}
+			var got string
+			if err := request.Validate(); err != nil {
+				got = err.Code
+			}
+			if got != tt.wantErr {
+				t.Errorf("Validate() = %q, want %q", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewResponse(t *testing.T) {
+	response := NewResponse(&Request{Version: 1, ID: "req-1"})
+	response.AddError(ErrorUnknownInterface, "wg9", "no matching interface")
+	js, err := json.Marshal(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"version":1,"id":"req-1","errors":[{"code":"unknown_interface","interface":"wg9","message":"no matching interface"}]}`
+	if string(js) != want {
+		t.Errorf("response = %s, want %s", js, want)
+	}
+}
+
+func TestRequestSelectInterfaces(t *testing.T) {
+	intFaces := []net.Interface{{Index: 1, Name: "dn42_a"}, {Index: 2, Name: "dn42_b"}, {Index: 3, Name: "wg0"}}
+	tests := []struct {
+		name       string
+		interfaces []string
+		want       []string
+		// wantErrs are the codes of the errors returned
+		wantErrs []string
+	}{
+		{"name", []string{"wg0"}, []string{"wg0"}, []string{}},
+		{"pattern", []string{"dn42_*"}, []string{"dn42_a", "dn42_b"}, []string{}},
+		{"overlapping patterns", []string{"dn42_*", "dn42_a"}, []string{"dn42_a", "dn42_b"}, []string{}},
+		{"unknown interface", []string{"wg0", "wg9"}, []string{"wg0"}, []string{ErrorUnknownInterface}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := &Request{Version: ProtocolVersion, Interfaces: tt.interfaces}
+			selected, errs := request.SelectInterfaces(intFaces)
+			got := make([]string, 0, len(selected))
+			for _, intFace := range selected {
+				got = append(got, intFace.Name)
+			}
+			gotErrs := make([]string, 0, len(errs))
+			for _, err := range errs {
+				gotErrs = append(gotErrs, err.Code)
+			}
+			if !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(gotErrs, tt.wantErrs) {
+				t.Errorf("SelectInterfaces() = %v, %v, want %v, %v", got, gotErrs, tt.want, tt.wantErrs)
+			}
+		})
+	}
+}
+
+func TestRequestTestOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    TestOptions
+		wantErr bool
+	}{
+		{"empty", `{"version": 1}`, TestOptions{Sources4: []net.IP{}, Sources6: []net.IP{}}, false},
+		{"options", `{"version": 1, "families": ["4"], "probe_count": 4, "timeout": "500ms", "src4": ["172.20.0.54"]}`,
+			TestOptions{
+				ProbeCount: 4,
+				Timeout:    500 * time.Millisecond,
+				Families:   FamilyIPv4,
+				Sources4:   []net.IP{net.ParseIP("172.20.0.54")},
+				Sources6:   []net.IP{},
+			}, false},
+		{"negative probe count", `{"version": 1, "probe_count": -1}`, TestOptions{}, true},
+		{"negative timeout", `{"version": 1, "timeout": "-1s"}`, TestOptions{}, true},
+		{"source of the wrong family", `{"version": 1, "src6": ["172.20.0.54"]}`, TestOptions{}, true},
+		{"unknown family", `{"version": 1, "families": ["ipx"]}`, TestOptions{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := &Request{}
+			if err := json.Unmarshal([]byte(tt.line), request); err != nil {
+				t.Fatal(err)
+			}
+			got, err := request.TestOptions()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TestOptions() error = %v, want error %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TestOptions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithOverride(t *testing.T) {
+	opts := TestOptions{
+		ProbeCount: 2,
+		Overrides:  map[string]TestOptions{"dn42_a": {ProbeCount: 3, Timeout: time.Second}},
+	}
+	intFaces := []net.Interface{{Name: "dn42_a"}, {Name: "dn42_b"}}
+	got := opts.WithOverride(intFaces, TestOptions{ProbeCount: 5})
+	want := map[string]TestOptions{
+		"dn42_a": {ProbeCount: 5, Timeout: time.Second},
+		"dn42_b": {ProbeCount: 5},
+	}
+	if !reflect.DeepEqual(got.Overrides, want) {
+		t.Errorf("WithOverride() overrides = %+v, want %+v", got.Overrides, want)
+	}
+	if len(opts.Overrides) != 1 {
+		t.Errorf("WithOverride() changed the overrides of the original options")
+	}
+}
@@ -0,0 +1,87 @@
+package peerTester
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// ECN codepoints of the two low bits of the IPv4 TOS and IPv6 traffic class
+const (
+	ECNNotECT = 0
+	ECNECT1   = 1
+	ECNECT0   = 2
+	ECNCE     = 3
+)
+
+// DSCPStatus tells what happened to the DSCP marking of the probes on the way
+type DSCPStatus string
+
+const (
+	DSCPKept      DSCPStatus = "kept"
+	DSCPBleached  DSCPStatus = "bleached"
+	DSCPRewritten DSCPStatus = "rewritten"
+)
+
+// QoS compares the DSCP and ECN bits the probes were sent with to those they arrived with
+type QoS struct {
+	SentDSCP     int
+	ReceivedDSCP int
+	DSCP         DSCPStatus
+	SentECN      int
+	ReceivedECN  int
+	// CongestionExperienced is set if a router on the way marked the probe with ECN CE
+	CongestionExperienced bool
+}
+
+func (q *QoS) String() string {
+	text := fmt.Sprintf("DSCP %d %s", q.SentDSCP, q.DSCP)
+	if q.DSCP == DSCPRewritten {
+		text += " to " + strconv.Itoa(q.ReceivedDSCP)
+	}
+	text += fmt.Sprintf(", ECN %d->%d", q.SentECN, q.ReceivedECN)
+	if q.CongestionExperienced {
+		text += " CE"
+	}
+	return text
+}
+
+// notable reports whether the probes were marked or the marking changed on the way
+func (q *QoS) notable() bool {
+	return q.SentDSCP != 0 || q.SentECN != 0 || q.DSCP != DSCPKept || q.ReceivedECN != q.SentECN
+}
+
+// ValidateMarking returns an error if the DSCP or ECN value does not fit into its bits
+func ValidateMarking(dscp int, ecn int) error {
+	if dscp < 0 || dscp > 63 {
+		return fmt.Errorf("invalid DSCP %d, must be between 0 and 63", dscp)
+	}
+	if ecn < 0 || ecn > 3 {
+		return fmt.Errorf("invalid ECN codepoint %d, must be between 0 and 3", ecn)
+	}
+	return nil
+}
+
+// trafficClass returns the IPv4 TOS or IPv6 traffic class of the probes
+func (o TestOptions) trafficClass() uint8 {
+	return uint8(o.DSCP<<2 | o.ECN)
+}
+
+// compareQoS compares the traffic class a probe was sent with to the received one
+func compareQoS(sent uint8, received uint8) *QoS {
+	q := &QoS{
+		SentDSCP:     int(sent >> 2),
+		ReceivedDSCP: int(received >> 2),
+		SentECN:      int(sent & 3),
+		ReceivedECN:  int(received & 3),
+	}
+	switch {
+	case q.ReceivedDSCP == q.SentDSCP:
+		q.DSCP = DSCPKept
+	case q.ReceivedDSCP == 0:
+		q.DSCP = DSCPBleached
+	default:
+		q.DSCP = DSCPRewritten
+	}
+	q.CongestionExperienced = q.ReceivedECN == ECNCE && q.SentECN != ECNCE
+	return q
+}
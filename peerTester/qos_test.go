@@ -0,0 +1,29 @@
+package peerTester
+
+import "testing"
+
+func TestCompareQoS(t *testing.T) {
+	tests := []struct {
+		name     string
+		sent     uint8
+		received uint8
+		want     QoS
+	}{
+		{"unmarked", 0, 0, QoS{DSCP: DSCPKept}},
+		{"DSCP kept", 46 << 2, 46 << 2, QoS{SentDSCP: 46, ReceivedDSCP: 46, DSCP: DSCPKept}},
+		{"DSCP bleached", 46 << 2, 0, QoS{SentDSCP: 46, DSCP: DSCPBleached}},
+		{"DSCP rewritten", 46 << 2, 8 << 2, QoS{SentDSCP: 46, ReceivedDSCP: 8, DSCP: DSCPRewritten}},
+		{"ECN kept", ECNECT0, ECNECT0, QoS{DSCP: DSCPKept, SentECN: ECNECT0, ReceivedECN: ECNECT0}},
+		{"ECN bleached", 10<<2 | ECNECT1, 10 << 2, QoS{SentDSCP: 10, ReceivedDSCP: 10, DSCP: DSCPKept, SentECN: ECNECT1}},
+		{"congestion experienced", ECNECT0, ECNCE,
+			QoS{DSCP: DSCPKept, SentECN: ECNECT0, ReceivedECN: ECNCE, CongestionExperienced: true}},
+		{"sent with CE", ECNCE, ECNCE, QoS{DSCP: DSCPKept, SentECN: ECNCE, ReceivedECN: ECNCE}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareQoS(tt.sent, tt.received); *got != tt.want {
+				t.Errorf("compareQoS() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
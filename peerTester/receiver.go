@@ -1,6 +1,7 @@
 package peerTester
 
 import (
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
 	"net"
@@ -11,40 +12,60 @@ import (
 	"time"
 )
 
-func listenIntoChannel(lst chan *ListenResult, stopChannel chan bool, wg *sync.WaitGroup, readyToListen *sync.WaitGroup) {
-	var stopping atomic.Bool
-	addr := net.UDPAddr{
-		Port: 5000,
+// openListener opens the UDP socket receiving the probes. A nil address listens on all addresses.
+func openListener(address net.IP, port int) (*net.UDPConn, error) {
+	network := "udp"
+	if address != nil {
+		if address.To4() != nil {
+			network = "udp4"
+		} else {
+			network = "udp6"
+		}
 	}
-	conn, err := net.ListenUDP("udp", &addr)
+	conn, err := net.ListenUDP(network, &net.UDPAddr{IP: address, Port: port})
 	if err != nil {
-		fmt.Print(err.Error())
-		os.Exit(1)
-	}
-	if !OutputJSON {
-		fmt.Println("Listening on udp port 5000")
+		return nil, err
 	}
 
 	rawConn, err := conn.SyscallConn()
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		_ = conn.Close()
+		return nil, err
 	}
 
+	var sockErr error
 	err = rawConn.Control(func(fd uintptr) {
-		if err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_RECVHOPLIMIT, 1); err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+		if network != "udp4" {
+			if sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_RECVHOPLIMIT, 1); sockErr != nil {
+				return
+			}
+			if sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_RECVTCLASS, 1); sockErr != nil {
+				return
+			}
 		}
-		if err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_RECVTTL, 1); err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+		if network != "udp6" {
+			if sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_RECVTTL, 1); sockErr != nil {
+				return
+			}
+			if sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_RECVTOS, 1); sockErr != nil {
+				return
+			}
 		}
+		// Kernel receive timestamps are optional, userspace timestamps are used otherwise
+		_ = enableRxTimestamps(int(fd))
 	})
+	if err == nil {
+		err = sockErr
+	}
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		_ = conn.Close()
+		return nil, err
 	}
+	return conn, nil
+}
+
+func listenIntoChannel(conn *net.UDPConn, dispatcher *resultDispatcher, stopChannel chan bool, wg *sync.WaitGroup) {
+	var stopping atomic.Bool
 
 	go func() {
 		<-stopChannel
@@ -52,12 +73,10 @@ func listenIntoChannel(lst chan *ListenResult, stopChannel chan bool, wg *sync.W
 		_ = conn.SetDeadline(time.Now())
 	}()
 
-	var monotonic uint16 = 0
-
-	readyToListen.Done()
+	// Path MTU probes are larger than the usual probes
+	var buf = make([]byte, maxPathMTU)
+	var oobBuf = make([]byte, 1500)
 	for {
-		var buf = make([]byte, 1500)
-		var oobBuf = make([]byte, 1500)
 		numRead, numReadOOB, _, remote, err := conn.ReadMsgUDP(buf, oobBuf)
 		receiveTime := time.Now()
 		if err != nil {
@@ -68,44 +87,109 @@ func listenIntoChannel(lst chan *ListenResult, stopChannel chan bool, wg *sync.W
 				os.Exit(1)
 			}
 		}
-		buf = buf[:numRead]
-		opened := hmacOpen([16]byte(hmacKey), buf)
+		packet := buf[:numRead]
+		opened := hmacOpen([16]byte(hmacKey), packet)
+		tampered := false
 		if opened == nil {
 			// Received message with invalid hmac
-			continue
+			metricHmacRejected.Add(1)
+			if len(packet) != 4+sha256.Size {
+				continue
+			}
+			// A probe of the expected length may have been rewritten on the way. Its plaintext
+			// header is used to report it to the test that sent it, which only accepts it if it
+			// matches an outstanding probe and comes from its source address and port.
+			opened = packet[:4]
+			tampered = true
 		}
 
-		if len(opened) != 3 {
+		if len(opened) < 4 {
 			continue
 		}
 		counter := uint16(opened[1]) | uint16(opened[0])<<8
-		id := opened[2]
-
-		if counter > monotonic {
-			monotonic = counter
-		} else if counter < monotonic {
-			continue
-		}
+		sourceIndex := opened[2]
+		id := opened[3]
 
 		ttlValue := parseOOBTTL(oobBuf[:numReadOOB])
+		trafficClass := parseOOBTrafficClass(oobBuf[:numReadOOB])
+
+		var kernelTimestamp bool
+		if ts, ok := parseOOBTimestamp(oobBuf[:numReadOOB]); ok {
+			receiveTime = ts
+			kernelTimestamp = true
+		}
 
 		isV4 := remote.IP.To4() != nil
 
-		lst <- &ListenResult{
+		dispatcher.dispatch(counter, &ListenResult{
 			remoteIP: remote.IP,
 			receiveTime: timeInfo{
-				id:   id,
-				time: receiveTime,
+				id:     id,
+				time:   receiveTime,
+				kernel: kernelTimestamp,
 			},
-			isV4:     isV4,
-			ttlValue: ttlValue,
-		}
+			sourceIndex:  sourceIndex,
+			isV4:         isV4,
+			remotePort:   remote.Port,
+			tampered:     tampered,
+			trafficClass: trafficClass,
+			TTL:          ttlValue,
+			Hops:         -1,
+		})
 	}
 	_ = conn.Close()
-	close(lst)
 	wg.Done()
 }
 
+// resultDispatcher routes received packets to the test waiting for them, based on the
+// counter embedded in the payload
+type resultDispatcher struct {
+	mu          sync.Mutex
+	channels    map[uint16]chan *ListenResult
+	nextCounter uint16
+}
+
+func newResultDispatcher() *resultDispatcher {
+	return &resultDispatcher{
+		channels: make(map[uint16]chan *ListenResult),
+	}
+}
+
+// register allocates an unused counter for a new test
+func (d *resultDispatcher) register(size int) (uint16, chan *ListenResult) {
+	c := make(chan *ListenResult, size)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for {
+		counter := d.nextCounter
+		d.nextCounter++
+		if _, inUse := d.channels[counter]; !inUse {
+			d.channels[counter] = c
+			return counter, c
+		}
+	}
+}
+
+func (d *resultDispatcher) unregister(counter uint16) {
+	d.mu.Lock()
+	delete(d.channels, counter)
+	d.mu.Unlock()
+}
+
+func (d *resultDispatcher) dispatch(counter uint16, result *ListenResult) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c, ok := d.channels[counter]
+	if !ok {
+		// Late or duplicate packet for a test that has already finished
+		return
+	}
+	select {
+	case c <- result:
+	default:
+	}
+}
+
 func parseOOBTTL(oobData []byte) (ttl int32) {
 	cMSGs, err := syscall.ParseSocketControlMessage(oobData)
 	if err != nil {
@@ -121,3 +205,21 @@ func parseOOBTTL(oobData []byte) (ttl int32) {
 	}
 	return -1
 }
+
+// parseOOBTrafficClass returns the IPv4 TOS or IPv6 traffic class of a received packet, or -1 if unknown
+func parseOOBTrafficClass(oobData []byte) int {
+	cMSGs, err := syscall.ParseSocketControlMessage(oobData)
+	if err != nil {
+		return -1
+	}
+	for _, msg := range cMSGs {
+		// IP_TOS is a single byte, IPV6_TCLASS an int
+		if msg.Header.Level == syscall.IPPROTO_IP && msg.Header.Type == syscall.IP_TOS && len(msg.Data) >= 1 {
+			return int(msg.Data[0])
+		}
+		if msg.Header.Level == syscall.IPPROTO_IPV6 && msg.Header.Type == syscall.IPV6_TCLASS && len(msg.Data) >= 4 {
+			return int(binary.NativeEndian.Uint32(msg.Data))
+		}
+	}
+	return -1
+}
@@ -0,0 +1,312 @@
+package peerTester
+
+import (
+	"net"
+	"os"
+	"time"
+)
+
+// ResultSchemaVersion is the version of the JSON result schema in schema/result.schema.json. It
+// is increased for changes that are not backwards compatible.
+const ResultSchemaVersion = 1
+
+// Version is the version of PeerTester, set at build time with
+// -ldflags "-X PeerTester/peerTester.Version=<version>"
+var Version = "dev"
+
+// RunMetadata describes a test run for the JSON report
+type RunMetadata struct {
+	Start time.Time
+	End   time.Time
+	// Dst4 and Dst6 are the default destinations. Interfaces may override them.
+	Dst4 net.IP
+	Dst6 net.IP
+}
+
+// Report is the JSON output of a test run
+type Report struct {
+	SchemaVersion int               `json:"schema_version"`
+	Tool          ReportTool        `json:"tool"`
+	Hostname      string            `json:"hostname"`
+	Start         time.Time         `json:"start"`
+	End           time.Time         `json:"end"`
+	Destinations  ReportAddresses   `json:"destinations"`
+	Interfaces    []ReportInterface `json:"interfaces"`
+}
+
+type ReportTool struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// ReportAddresses holds an address of each family, null if the family is not tested. Addresses
+// that may be unknown are *string, as a nil net.IP is encoded as an empty string.
+type ReportAddresses struct {
+	IPv4 *string `json:"ipv4"`
+	IPv6 *string `json:"ipv6"`
+}
+
+type ReportInterface struct {
+	Name string `json:"name"`
+	// Index is the kernel interface index
+	Index int `json:"index"`
+	// Alias is set with "ip link set <if> alias <text>"
+	Alias   string         `json:"alias"`
+	Peer    *ReportPeer    `json:"peer"`
+	BGP     []ReportBGP    `json:"bgp"`
+	Results []ReportResult `json:"results"`
+}
+
+type ReportPeer struct {
+	Name string `json:"name"`
+	ASN  uint32 `json:"asn"`
+}
+
+type ReportBGP struct {
+	Protocol        string  `json:"protocol"`
+	State           string  `json:"state"`
+	NeighborAddress *string `json:"neighbor_address"`
+	NeighborAS      uint32  `json:"neighbor_as"`
+	Interface       string  `json:"interface"`
+}
+
+// ReportResult is the result of one source address. Fields that are unknown are null.
+type ReportResult struct {
+	Family string `json:"family"`
+	// Primary is set for the result that represents the address family, which is the one of the
+	// first source address
+	Primary         bool             `json:"primary"`
+	Status          string           `json:"status"`
+	Message         string           `json:"message"`
+	Source          *string          `json:"source"`
+	Destination     *string          `json:"destination"`
+	LatencyUs       *int64           `json:"latency_us"`
+	PacketsSent     int              `json:"packets_sent"`
+	PacketsLost     int              `json:"packets_lost"`
+	TTL             *int32           `json:"ttl"`
+	Hops            *int             `json:"hops"`
+	ObservedSource  *ReportEndpoint  `json:"observed_source"`
+	TimestampSource *string          `json:"timestamp_source"`
+	Stats           *ReportStats     `json:"stats"`
+	Probes          []ReportProbe    `json:"probes"`
+	ICMPError       *ReportICMPError `json:"icmp_error"`
+	ICMPUnavailable bool             `json:"icmp_unavailable"`
+	NAT             *ReportNAT       `json:"nat"`
+	Trace           []ReportHop      `json:"trace"`
+	PathMTU         *ReportPathMTU   `json:"path_mtu"`
+	QoS             *ReportQoS       `json:"qos"`
+}
+
+// ReportEndpoint is the source address and port a probe arrived with
+type ReportEndpoint struct {
+	Address net.IP `json:"address"`
+	Port    int    `json:"port"`
+}
+
+// ReportStats holds the RTT statistics in microseconds
+type ReportStats struct {
+	MinUs    float64 `json:"min_us"`
+	MaxUs    float64 `json:"max_us"`
+	MeanUs   float64 `json:"mean_us"`
+	MedianUs float64 `json:"median_us"`
+	StdDevUs float64 `json:"stddev_us"`
+	JitterUs float64 `json:"jitter_us"`
+	P95Us    float64 `json:"p95_us"`
+}
+
+// ReportProbe is a probe sent to the peer. Received and RTTUs are null for lost probes.
+type ReportProbe struct {
+	Sequence int        `json:"sequence"`
+	Sent     time.Time  `json:"sent"`
+	Received *time.Time `json:"received"`
+	RTTUs    *int64     `json:"rtt_us"`
+}
+
+type ReportICMPError struct {
+	Type   uint8   `json:"type"`
+	Code   uint8   `json:"code"`
+	Sender *string `json:"sender"`
+}
+
+type ReportNAT struct {
+	Kind            NATKind `json:"kind"`
+	ObservedAddress *string `json:"observed_address"`
+	ObservedPort    int     `json:"observed_port"`
+	ExpectedPort    *int    `json:"expected_port"`
+}
+
+type ReportHop struct {
+	TTL         int     `json:"ttl"`
+	Address     *string `json:"address"`
+	RTTUs       *int64  `json:"rtt_us"`
+	Destination bool    `json:"destination"`
+}
+
+type ReportPathMTU struct {
+	MTU          *int                 `json:"mtu"`
+	InterfaceMTU int                  `json:"interface_mtu"`
+	TooBig       []ReportPacketTooBig `json:"too_big"`
+}
+
+type ReportPacketTooBig struct {
+	Sender *string `json:"sender"`
+	Size   int     `json:"size"`
+	MTU    *int    `json:"mtu"`
+}
+
+type ReportQoS struct {
+	SentDSCP              int        `json:"sent_dscp"`
+	ReceivedDSCP          int        `json:"received_dscp"`
+	DSCP                  DSCPStatus `json:"dscp"`
+	SentECN               int        `json:"sent_ecn"`
+	ReceivedECN           int        `json:"received_ecn"`
+	CongestionExperienced bool       `json:"congestion_experienced"`
+}
+
+// NewReport returns the JSON report of the results of a run. Interfaces are sorted by name.
+func NewReport(names []string, resultMap map[string]*IntFaceResult, meta RunMetadata) *Report {
+	hostname, _ := os.Hostname()
+	report := &Report{
+		SchemaVersion: ResultSchemaVersion,
+		Tool:          ReportTool{Name: "peertester", Version: Version},
+		Hostname:      hostname,
+		Start:         meta.Start,
+		End:           meta.End,
+		Destinations:  ReportAddresses{IPv4: reportAddress(meta.Dst4), IPv6: reportAddress(meta.Dst6)},
+		Interfaces:    make([]ReportInterface, 0, len(names)),
+	}
+	for _, name := range names {
+		report.Interfaces = append(report.Interfaces, newReportInterface(name, resultMap[name]))
+	}
+	return report
+}
+
+func newReportInterface(name string, r *IntFaceResult) ReportInterface {
+	i := ReportInterface{
+		Name:    name,
+		Index:   r.index,
+		Alias:   r.alias,
+		BGP:     make([]ReportBGP, 0, len(r.BGP)),
+		Results: make([]ReportResult, 0),
+	}
+	if r.Peer != nil {
+		i.Peer = &ReportPeer{Name: r.Peer.Name, ASN: r.Peer.ASN}
+	}
+	for _, session := range r.BGP {
+		i.BGP = append(i.BGP, ReportBGP{
+			Protocol:        session.Protocol,
+			State:           session.State,
+			NeighborAddress: reportAddress(session.NeighborAddress),
+			NeighborAS:      session.NeighborAS,
+			Interface:       session.Interface,
+		})
+	}
+	for _, c := range r.testCases() {
+		i.Results = append(i.Results, newReportResult(c))
+	}
+	return i
+}
+
+func newReportResult(c testCase) ReportResult {
+	r := c.result
+	result := ReportResult{
+		Family:      c.family,
+		Primary:     c.source == "",
+		Status:      r.Status.String(),
+		Message:     r.ErrorText,
+		Source:      reportAddress(r.source),
+		Destination: reportAddress(r.destination),
+		PacketsSent: len(r.probes),
+		PacketsLost: r.PacketsLost,
+		Probes:      make([]ReportProbe, 0, len(r.probes)),
+
+		ICMPUnavailable: r.ICMPUnavailable,
+	}
+	if r.LatencyUs >= 0 {
+		result.LatencyUs = &r.LatencyUs
+	}
+	if r.TTL >= 0 {
+		result.TTL = &r.TTL
+	}
+	if r.Hops >= 0 {
+		result.Hops = &r.Hops
+	}
+	if r.remoteIP != nil {
+		result.ObservedSource = &ReportEndpoint{Address: r.remoteIP, Port: r.remotePort}
+	}
+	if r.TimestampSource != "" {
+		result.TimestampSource = &r.TimestampSource
+	}
+	if s := r.Stats; s != nil {
+		result.Stats = &ReportStats{
+			MinUs:    s.Min,
+			MaxUs:    s.Max,
+			MeanUs:   s.Mean,
+			MedianUs: s.Median,
+			StdDevUs: s.StdDev,
+			JitterUs: s.Jitter,
+			P95Us:    s.P95,
+		}
+	}
+	for _, probe := range r.probes {
+		p := ReportProbe{Sequence: int(probe.id), Sent: probe.sent}
+		if !probe.received.IsZero() {
+			received := probe.received
+			rtt := received.Sub(probe.sent).Microseconds()
+			p.Received, p.RTTUs = &received, &rtt
+		}
+		result.Probes = append(result.Probes, p)
+	}
+	if e := r.ICMPError; e != nil {
+		result.ICMPError = &ReportICMPError{Type: e.Type, Code: e.Code, Sender: reportAddress(e.Sender)}
+	}
+	if n := r.NAT; n != nil {
+		result.NAT = &ReportNAT{Kind: n.Kind, ObservedAddress: reportAddress(n.ObservedAddress), ObservedPort: n.ObservedPort}
+		if n.ExpectedPort != 0 {
+			result.NAT.ExpectedPort = &n.ExpectedPort
+		}
+	}
+	if r.Trace != nil {
+		result.Trace = make([]ReportHop, 0, len(r.Trace))
+		for _, hop := range r.Trace {
+			h := ReportHop{TTL: hop.TTL, Address: reportAddress(hop.Address), Destination: hop.Destination}
+			if hop.RTTUs >= 0 {
+				h.RTTUs = &hop.RTTUs
+			}
+			result.Trace = append(result.Trace, h)
+		}
+	}
+	if m := r.PathMTU; m != nil {
+		result.PathMTU = &ReportPathMTU{InterfaceMTU: m.InterfaceMTU, TooBig: make([]ReportPacketTooBig, 0, len(m.TooBig))}
+		if m.MTU >= 0 {
+			result.PathMTU.MTU = &m.MTU
+		}
+		for _, message := range m.TooBig {
+			tooBig := ReportPacketTooBig{Sender: reportAddress(message.Sender), Size: message.Size}
+			if message.MTU != 0 {
+				tooBig.MTU = &message.MTU
+			}
+			result.PathMTU.TooBig = append(result.PathMTU.TooBig, tooBig)
+		}
+	}
+	if q := r.QoS; q != nil {
+		result.QoS = &ReportQoS{
+			SentDSCP:              q.SentDSCP,
+			ReceivedDSCP:          q.ReceivedDSCP,
+			DSCP:                  q.DSCP,
+			SentECN:               q.SentECN,
+			ReceivedECN:           q.ReceivedECN,
+			CongestionExperienced: q.CongestionExperienced,
+		}
+	}
+	return result
+}
+
+// reportAddress returns the address as text, or nil if it is unknown
+func reportAddress(ip net.IP) *string {
+	if ip == nil {
+		return nil
+	}
+	text := ip.String()
+	return &text
+}
@@ -0,0 +1,251 @@
+package peerTester
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// reportResults returns results that fill every optional part of the report
+func reportResults() map[string]*IntFaceResult {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	passed := newListenResult(OK, "OK")
+	passed.LatencyUs, passed.TTL, passed.Hops = 1500, 64, 0
+	passed.TimestampSource = "kernel"
+	passed.Stats = &LatencyStats{Min: 1000, Max: 2000, Mean: 1500, Median: 1500, StdDev: 500, Jitter: 1000, P95: 1950}
+	passed.source, passed.destination = net.ParseIP("172.20.0.53"), net.ParseIP("172.22.108.1")
+	passed.remoteIP, passed.remotePort = net.ParseIP("172.20.0.53"), 5000
+	passed.probes = []probeTiming{
+		{id: 0, sent: start, received: start.Add(time.Millisecond)},
+		{id: 1, sent: start.Add(15 * time.Millisecond), received: start.Add(17 * time.Millisecond)},
+	}
+	passed.NAT = &NATFinding{Kind: NATPortOnly, ObservedAddress: net.ParseIP("172.20.0.53"), ObservedPort: 40000, ExpectedPort: 5000}
+	passed.PathMTU = &PathMTU{MTU: 1420, InterfaceMTU: 1500, TooBig: []PacketTooBig{{Sender: net.ParseIP("172.20.1.1"), Size: 1500, MTU: 1420}}}
+	passed.QoS = &QoS{SentDSCP: 46, ReceivedDSCP: 0, DSCP: DSCPBleached, SentECN: 2, ReceivedECN: 2}
+
+	failed := newListenResult(PeerNoRoute, "No route")
+	failed.PacketsLost = 1
+	failed.source, failed.destination = net.ParseIP("fd42:d42:d42:54::1"), net.ParseIP("fd42:4242:108::1")
+	failed.probes = []probeTiming{{id: 0, sent: start}}
+	failed.ICMPError = &ICMPError{Type: 1, Code: 0, Sender: net.ParseIP("fe80::1")}
+	failed.Trace = []Hop{{TTL: 1, Address: net.ParseIP("fe80::1"), RTTUs: 800}, {TTL: 2, RTTUs: -1}}
+	failed.PathMTU = &PathMTU{MTU: -1, InterfaceMTU: 1420, TooBig: []PacketTooBig{}}
+
+	other := newListenResult(Timeout, "Timeout")
+	other.PacketsLost = 1
+	other.source = net.ParseIP("fd42:4242:108::53")
+	other.ICMPUnavailable = true
+
+	return map[string]*IntFaceResult{
+		"dn42_a": {
+			V4:       passed,
+			V6:       failed,
+			BySource: map[string]*ListenResult{"fd42:d42:d42:54::1": failed, "fd42:4242:108::53": other},
+			Peer:     &PeerInfo{Name: "alice", ASN: 4242420001},
+			BGP:      []BGPSession{{Protocol: "dn42_alice", State: "Established", NeighborAddress: net.ParseIP("fe80::1"), NeighborAS: 4242420001, Interface: "dn42_a"}},
+			index:    7,
+			alias:    "alice",
+		},
+		"dn42_b": {V4: newListenResult(Disabled, "Disabled"), V6: newListenResult(NotConfigured, "Not configured")},
+	}
+}
+
+func TestReportSchema(t *testing.T) {
+	content, err := os.ReadFile("../schema/result.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(content, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	report := NewReport([]string{"dn42_a", "dn42_b"}, reportResults(), RunMetadata{
+		Start: start,
+		End:   start.Add(time.Second),
+		Dst4:  net.ParseIP("172.22.108.1"),
+	})
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var document any
+	if err := json.Unmarshal(encoded, &document); err != nil {
+		t.Fatal(err)
+	}
+	validator := &schemaValidator{root: schema}
+	for _, problem := range validator.validate(schema, document, "") {
+		t.Error(problem)
+	}
+}
+
+func TestReportStatusEnum(t *testing.T) {
+	content, err := os.ReadFile("../schema/result.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Defs struct {
+			Status struct {
+				Enum []string `json:"enum"`
+			} `json:"status"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(content, &schema); err != nil {
+		t.Fatal(err)
+	}
+	want := make([]string, 0)
+	for result := OK; result <= PayloadTampered; result++ {
+		want = append(want, result.String())
+	}
+	if !reflect.DeepEqual(schema.Defs.Status.Enum, want) {
+		t.Errorf("schema status enum = %v, want %v", schema.Defs.Status.Enum, want)
+	}
+}
+
+// schemaValidator checks a document against the subset of JSON Schema used by the result schema.
+// Unlike JSON Schema, it also reports object keys that the schema does not describe.
+type schemaValidator struct {
+	root map[string]any
+}
+
+func (v *schemaValidator) validate(schema map[string]any, value any, path string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		return v.validate(v.resolve(ref), value, path)
+	}
+	problems := make([]string, 0)
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		matched := false
+		for _, option := range anyOf {
+			if len(v.validate(option.(map[string]any), value, path)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			problems = append(problems, fmt.Sprintf("%s: %v matches no option", path, value))
+		}
+	}
+	if types, ok := schema["type"]; ok && !matchesType(types, value) {
+		return append(problems, fmt.Sprintf("%s: %v is not of type %v", path, value, types))
+	}
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, value) {
+		problems = append(problems, fmt.Sprintf("%s: %v is not one of %v", path, value, enum))
+	}
+	if constant, ok := schema["const"]; ok && constant != value {
+		problems = append(problems, fmt.Sprintf("%s: %v is not %v", path, value, constant))
+	}
+	if format, ok := schema["format"].(string); ok && !matchesFormat(format, value) {
+		problems = append(problems, fmt.Sprintf("%s: %v is not a %s", path, value, format))
+	}
+	if number, ok := value.(float64); ok {
+		if minimum, ok := schema["minimum"].(float64); ok && number < minimum {
+			problems = append(problems, fmt.Sprintf("%s: %v is below %v", path, number, minimum))
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && number > maximum {
+			problems = append(problems, fmt.Sprintf("%s: %v is above %v", path, number, maximum))
+		}
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		for _, key := range asStrings(schema["required"]) {
+			if _, ok := value[key]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing %s", path, key))
+			}
+		}
+		if properties, ok := schema["properties"].(map[string]any); ok {
+			for key, property := range value {
+				propertySchema, ok := properties[key].(map[string]any)
+				if !ok {
+					problems = append(problems, fmt.Sprintf("%s: %s is not described by the schema", path, key))
+					continue
+				}
+				problems = append(problems, v.validate(propertySchema, property, path+"/"+key)...)
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range value {
+				problems = append(problems, v.validate(items, item, fmt.Sprintf("%s/%d", path, i))...)
+			}
+		}
+	}
+	return problems
+}
+
+func (v *schemaValidator) resolve(ref string) map[string]any {
+	var node any = v.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		node = node.(map[string]any)[part]
+	}
+	return node.(map[string]any)
+}
+
+func matchesType(types any, value any) bool {
+	for _, name := range asStrings(types) {
+		var ok bool
+		switch name {
+		case "object":
+			_, ok = value.(map[string]any)
+		case "array":
+			_, ok = value.([]any)
+		case "string":
+			_, ok = value.(string)
+		case "boolean":
+			_, ok = value.(bool)
+		case "number":
+			_, ok = value.(float64)
+		case "integer":
+			number, isNumber := value.(float64)
+			ok = isNumber && number == float64(int64(number))
+		case "null":
+			ok = value == nil
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesFormat(format string, value any) bool {
+	text, ok := value.(string)
+	if !ok {
+		return true
+	}
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339Nano, text)
+		return err == nil
+	case "ipv4":
+		ip := net.ParseIP(text)
+		return ip != nil && ip.To4() != nil
+	case "ipv6":
+		ip := net.ParseIP(text)
+		return ip != nil && ip.To4() == nil
+	}
+	return true
+}
+
+// asStrings returns a string or a list of strings from a decoded JSON document as a list
+func asStrings(value any) []string {
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []any:
+		strs := make([]string, 0, len(value))
+		for _, entry := range value {
+			strs = append(strs, entry.(string))
+		}
+		return strs
+	}
+	return nil
+}
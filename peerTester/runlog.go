@@ -0,0 +1,360 @@
+package peerTester
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultRunLog is the run log read by the history and diff subcommands if none is given
+const DefaultRunLog = "/var/lib/peertester/history.jsonl"
+
+// DefaultRunLogMaxSize is the size in bytes at which the run log is rotated
+const DefaultRunLogMaxSize = 16 << 20
+
+// Run is a test run recorded in the run log
+type Run struct {
+	// ID numbers the runs of a log, starting at 1
+	ID      int                       `json:"id"`
+	Time    time.Time                 `json:"time"`
+	Dst4    net.IP                    `json:"dst4,omitempty"`
+	Dst6    net.IP                    `json:"dst6,omitempty"`
+	Results map[string]*IntFaceResult `json:"results"`
+}
+
+// RunLog appends test runs to a file with one JSON object per line. The file is locked while a
+// run is appended, so that several processes can share it. Once the file is larger than MaxSize,
+// it is renamed to Path + ".1", replacing the previous one, and a new file is started.
+type RunLog struct {
+	Path string
+	// MaxSize is the size in bytes at which the log is rotated, or 0 to never rotate it
+	MaxSize int64
+}
+
+func NewRunLog(path string) *RunLog {
+	return &RunLog{Path: path, MaxSize: DefaultRunLogMaxSize}
+}
+
+// Append records a run and returns its ID
+func (l *RunLog) Append(dst4 net.IP, dst6 net.IP, results map[string]*IntFaceResult) (int, error) {
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0755); err != nil {
+		return 0, err
+	}
+	f, err := l.openLocked()
+	if err != nil {
+		return 0, err
+	}
+	// f is replaced by the new file when the log is rotated
+	defer func() {
+		_ = f.Close()
+	}()
+
+	lastID, size, err := lastRunID(f, l.Path)
+	if err != nil {
+		return 0, err
+	}
+	if size == 0 {
+		// The IDs continue after the runs of the rotated file
+		if lastID, err = l.rotatedLastID(); err != nil {
+			return 0, err
+		}
+	}
+	if l.MaxSize > 0 && size >= l.MaxSize {
+		// Processes waiting for the lock notice the rename and open the new file
+		if err := os.Rename(l.Path, l.Path+".1"); err != nil {
+			return 0, err
+		}
+		_ = f.Close()
+		if f, err = l.openLocked(); err != nil {
+			return 0, err
+		}
+	}
+
+	run := Run{ID: lastID + 1, Time: time.Now(), Dst4: dst4, Dst6: dst6, Results: results}
+	line, err := json.Marshal(run)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return 0, err
+	}
+	return run.ID, nil
+}
+
+// openLocked opens the log for appending and locks it. If the log was rotated while waiting for
+// the lock, the new file is opened.
+func (l *RunLog) openLocked() (*os.File, error) {
+	for {
+		f, err := os.OpenFile(l.Path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		opened, err := f.Stat()
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		current, err := os.Stat(l.Path)
+		if err == nil && os.SameFile(opened, current) {
+			return f, nil
+		}
+		_ = f.Close()
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+}
+
+// rotatedLastID returns the ID of the last run of the rotated file, or 0 if there is none
+func (l *RunLog) rotatedLastID() (int, error) {
+	f, err := os.Open(l.Path + ".1")
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	lastID, _, err := lastRunID(f, l.Path+".1")
+	return lastID, err
+}
+
+// lastRunID returns the ID of the last complete run and the size of the log. Only the end of the
+// file is read.
+func lastRunID(f *os.File, path string) (int, int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	offset := info.Size()
+	var tail []byte
+	for offset > 0 {
+		n := min(offset, 4096)
+		offset -= n
+		chunk := make([]byte, n)
+		if _, err := f.ReadAt(chunk, offset); err != nil {
+			return 0, 0, err
+		}
+		tail = append(chunk, tail...)
+
+		// The last complete line ends with the last newline and starts after the one before it
+		end := bytes.LastIndexByte(tail, '\n')
+		if end < 0 {
+			continue
+		}
+		start := bytes.LastIndexByte(tail[:end], '\n')
+		if start < 0 && offset > 0 {
+			continue
+		}
+		var last struct {
+			ID int `json:"id"`
+		}
+		if err := json.Unmarshal(tail[start+1:end], &last); err != nil {
+			return 0, 0, fmt.Errorf("%s: last run: %s", path, err)
+		}
+		return last.ID, info.Size(), nil
+	}
+	return 0, info.Size(), nil
+}
+
+// Runs returns all runs of the log in the order they were recorded, including those of the
+// rotated file
+func (l *RunLog) Runs() ([]Run, error) {
+	runs := make([]Run, 0)
+	for _, path := range []string{l.Path + ".1", l.Path} {
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = readRuns(f, path, func(line []byte) error {
+			var run Run
+			if err := json.Unmarshal(line, &run); err != nil {
+				return err
+			}
+			runs = append(runs, run)
+			return nil
+		})
+		_ = f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return runs, nil
+}
+
+// readRuns passes every complete line of the log to decode
+func readRuns(r io.Reader, path string, decode func(line []byte) error) error {
+	reader := bufio.NewReader(r)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		// A last line without newline is a run that is still being written
+		if len(line) != 0 && line[len(line)-1] == '\n' {
+			if err := decode(line); err != nil {
+				return fmt.Errorf("%s:%d: %s", path, lineNumber, err)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// FindRun returns the run with the given ID. "last" is the last run and "last~n" the run n runs
+// before it.
+func FindRun(runs []Run, reference string) (*Run, error) {
+	if back, ok := strings.CutPrefix(reference, "last"); ok {
+		n := 0
+		if back != "" {
+			var err error
+			if n, err = strconv.Atoi(strings.TrimPrefix(back, "~")); err != nil || !strings.HasPrefix(back, "~") || n < 0 {
+				return nil, fmt.Errorf("invalid run %q", reference)
+			}
+		}
+		if n >= len(runs) {
+			return nil, fmt.Errorf("run %s not found, %d runs recorded", reference, len(runs))
+		}
+		return &runs[len(runs)-1-n], nil
+	}
+
+	id, err := strconv.Atoi(reference)
+	if err != nil {
+		return nil, fmt.Errorf("invalid run %q", reference)
+	}
+	for i := range runs {
+		if runs[i].ID == id {
+			return &runs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("run %d not found", id)
+}
+
+// ChangeKind is the kind of difference between the results of two runs
+type ChangeKind string
+
+const (
+	ChangeRegressed ChangeKind = "regressed"
+	ChangeRecovered ChangeKind = "recovered"
+	// ChangeStatus is reported for other status changes, such as a failing address family that
+	// fails for another reason or an address family that is no longer tested
+	ChangeStatus         ChangeKind = "status_changed"
+	ChangeTTL            ChangeKind = "ttl_changed"
+	ChangeLatency        ChangeKind = "latency_shifted"
+	ChangeInterfaceAdded ChangeKind = "interface_added"
+	ChangeInterfaceGone  ChangeKind = "interface_removed"
+)
+
+const (
+	// latencyShiftRatio and latencyShiftMinUs define a significant latency shift: the mean RTT
+	// changes by more than the ratio and by more than the absolute amount
+	latencyShiftRatio = 0.5
+	latencyShiftMinUs = 2000
+)
+
+// RunChange is a difference between the results of an interface in two runs
+type RunChange struct {
+	Interface string     `json:"interface"`
+	Family    string     `json:"family,omitempty"`
+	Kind      ChangeKind `json:"kind"`
+	Before    string     `json:"before,omitempty"`
+	After     string     `json:"after,omitempty"`
+}
+
+// DiffRuns returns the changes from run a to run b, ordered by interface name
+func DiffRuns(a *Run, b *Run) []RunChange {
+	names := slices.Sorted(maps.Keys(a.Results))
+	for name := range b.Results {
+		if _, ok := a.Results[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	changes := make([]RunChange, 0)
+	for _, name := range names {
+		before, after := a.Results[name], b.Results[name]
+		if before == nil {
+			changes = append(changes, RunChange{Interface: name, Kind: ChangeInterfaceAdded})
+			continue
+		}
+		if after == nil {
+			changes = append(changes, RunChange{Interface: name, Kind: ChangeInterfaceGone})
+			continue
+		}
+		for _, family := range []struct {
+			name          string
+			before, after *ListenResult
+		}{{"ipv4", before.V4, after.V4}, {"ipv6", before.V6, after.V6}} {
+			if family.before == nil || family.after == nil {
+				continue
+			}
+			for _, change := range diffResults(family.before, family.after) {
+				change.Interface = name
+				change.Family = family.name
+				changes = append(changes, change)
+			}
+		}
+	}
+	return changes
+}
+
+func diffResults(before *ListenResult, after *ListenResult) []RunChange {
+	changes := make([]RunChange, 0)
+	status := RunChange{Before: before.Status.String(), After: after.Status.String()}
+	switch {
+	case !before.Status.Failed() && after.Status.Failed():
+		status.Kind = ChangeRegressed
+	case before.Status.Failed() && !after.Status.Failed():
+		status.Kind = ChangeRecovered
+	case before.Status != after.Status:
+		status.Kind = ChangeStatus
+	}
+	if status.Kind != "" {
+		changes = append(changes, status)
+	}
+
+	if before.TTL >= 0 && after.TTL >= 0 && before.TTL != after.TTL {
+		changes = append(changes, RunChange{
+			Kind:   ChangeTTL,
+			Before: strconv.Itoa(int(before.TTL)),
+			After:  strconv.Itoa(int(after.TTL)),
+		})
+	}
+	if before.LatencyUs >= 0 && after.LatencyUs >= 0 {
+		shift := after.LatencyUs - before.LatencyUs
+		if shift < 0 {
+			shift = -shift
+		}
+		if shift > latencyShiftMinUs && float64(shift) > latencyShiftRatio*float64(before.LatencyUs) {
+			changes = append(changes, RunChange{
+				Kind:   ChangeLatency,
+				Before: formatLatency(before.LatencyUs),
+				After:  formatLatency(after.LatencyUs),
+			})
+		}
+	}
+	return changes
+}
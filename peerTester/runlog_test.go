@@ -0,0 +1,200 @@
+package peerTester
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func runIDs(runs []Run) []int {
+	ids := make([]int, len(runs))
+	for i, run := range runs {
+		ids[i] = run.ID
+	}
+	return ids
+}
+
+func TestRunLogAppend(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSize int64
+		appends int
+		// want are the IDs of the runs kept
+		want        []int
+		wantRotated bool
+	}{
+		{"no rotation", 0, 5, []int{1, 2, 3, 4, 5}, false},
+		{"below the maximum size", 1 << 20, 5, []int{1, 2, 3, 4, 5}, false},
+		{"rotation on every run", 1, 5, []int{4, 5}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &RunLog{Path: filepath.Join(t.TempDir(), "history.jsonl"), MaxSize: tt.maxSize}
+			results := map[string]*IntFaceResult{"dn42_test": statusResult(OK)}
+			for i := 1; i <= tt.appends; i++ {
+				id, err := l.Append(nil, nil, results)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if id != i {
+					t.Fatalf("Append() = %d, want %d", id, i)
+				}
+			}
+			runs, err := l.Runs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := runIDs(runs); !equalInts(got, tt.want) {
+				t.Errorf("Runs() IDs = %v, want %v", got, tt.want)
+			}
+			if _, err := os.Stat(l.Path + ".1"); (err == nil) != tt.wantRotated {
+				t.Errorf("rotated file exists = %t, want %t", err == nil, tt.wantRotated)
+			}
+			if runs[len(runs)-1].Results["dn42_test"].V4.Status != OK {
+				t.Errorf("results were not recorded: %+v", runs[len(runs)-1].Results)
+			}
+		})
+	}
+}
+
+func TestLastRunID(t *testing.T) {
+	long := `{"id":2,"results":{"x":"` + strings.Repeat("a", 10000) + `"}}` + "\n"
+	tests := []struct {
+		name    string
+		content string
+		want    int
+		wantErr bool
+	}{
+		{"empty", "", 0, false},
+		{"single run", `{"id":1}` + "\n", 1, false},
+		{"run longer than a read", `{"id":1}` + "\n" + long, 2, false},
+		{"first run longer than a read", long, 2, false},
+		{"incomplete last line", `{"id":7}` + "\n" + `{"id":8,"resu`, 7, false},
+		{"incomplete only line", `{"id":8,"resu`, 0, false},
+		{"corrupt", "garbage\n", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "history.jsonl")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = f.Close() }()
+			got, size, err := lastRunID(f, path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("lastRunID() error = %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("lastRunID() = %d, want %d", got, tt.want)
+			}
+			if !tt.wantErr && size != int64(len(tt.content)) {
+				t.Errorf("lastRunID() size = %d, want %d", size, len(tt.content))
+			}
+		})
+	}
+}
+
+func TestFindRun(t *testing.T) {
+	runs := []Run{{ID: 3}, {ID: 4}, {ID: 7}}
+	tests := []struct {
+		reference string
+		// want is the ID of the run found, or 0 for an error
+		want int
+	}{
+		{"last", 7},
+		{"last~0", 7},
+		{"last~2", 3},
+		{"last~3", 0},
+		{"last2", 0},
+		{"last~-1", 0},
+		{"4", 4},
+		{"5", 0},
+		{"first", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reference, func(t *testing.T) {
+			got, err := FindRun(runs, tt.reference)
+			if tt.want == 0 {
+				if err == nil {
+					t.Fatalf("FindRun() = run %d, want an error", got.ID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.ID != tt.want {
+				t.Errorf("FindRun() = run %d, want %d", got.ID, tt.want)
+			}
+		})
+	}
+	if _, err := FindRun(nil, "last"); err == nil {
+		t.Error("FindRun() without runs returned no error")
+	}
+}
+
+func TestDiffRuns(t *testing.T) {
+	result := func(status testResult, ttl int32, latencyUs int64) *ListenResult {
+		r := newListenResult(status, "")
+		r.TTL, r.LatencyUs = ttl, latencyUs
+		return r
+	}
+	run := func(v4 *ListenResult, v6 *ListenResult) *Run {
+		return &Run{Results: map[string]*IntFaceResult{"dn42_test": {V4: v4, V6: v6}}}
+	}
+	ok := result(OK, 64, 10000)
+	tests := []struct {
+		name string
+		a, b *Run
+		want []RunChange
+	}{
+		{"unchanged", run(ok, ok), run(ok, ok), []RunChange{}},
+		{"regressed", run(ok, ok), run(result(Timeout, -1, -1), ok), []RunChange{
+			{Interface: "dn42_test", Family: "ipv4", Kind: ChangeRegressed, Before: "ok", After: "timeout"},
+		}},
+		{"recovered", run(ok, result(PeerFiltered, -1, -1)), run(ok, ok), []RunChange{
+			{Interface: "dn42_test", Family: "ipv6", Kind: ChangeRecovered, Before: "peer_filtered", After: "ok"},
+		}},
+		{"failing for another reason", run(result(Timeout, -1, -1), ok), run(result(PeerNoRoute, -1, -1), ok), []RunChange{
+			{Interface: "dn42_test", Family: "ipv4", Kind: ChangeStatus, Before: "timeout", After: "peer_no_route"},
+		}},
+		{"no longer tested", run(ok, ok), run(ok, result(Disabled, -1, -1)), []RunChange{
+			{Interface: "dn42_test", Family: "ipv6", Kind: ChangeStatus, Before: "ok", After: "disabled"},
+		}},
+		{"TTL changed", run(ok, ok), run(result(OK, 63, 10000), ok), []RunChange{
+			{Interface: "dn42_test", Family: "ipv4", Kind: ChangeTTL, Before: "64", After: "63"},
+		}},
+		{"latency shifted", run(ok, ok), run(ok, result(OK, 64, 16000)), []RunChange{
+			{Interface: "dn42_test", Family: "ipv6", Kind: ChangeLatency, Before: "10.000ms", After: "16.000ms"},
+		}},
+		{"latency shift below the ratio", run(ok, ok), run(ok, result(OK, 64, 14000)), []RunChange{}},
+		{"latency shift below the minimum", run(result(OK, 64, 1000), ok), run(result(OK, 64, 2500), ok), []RunChange{}},
+		{"interface added", &Run{}, run(ok, ok), []RunChange{{Interface: "dn42_test", Kind: ChangeInterfaceAdded}}},
+		{"interface removed", run(ok, ok), &Run{}, []RunChange{{Interface: "dn42_test", Kind: ChangeInterfaceGone}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DiffRuns(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffRuns() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func equalInts(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,267 @@
+package peerTester
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const iflaInfoKind = 1
+
+// InterfaceSelector selects the interfaces to test
+type InterfaceSelector struct {
+	// Include and Exclude hold interface names, glob patterns such as "dn42*" or regular
+	// expressions enclosed in slashes such as "/^wg[0-9]+$/". An empty Include selects all interfaces.
+	Include []string
+	Exclude []string
+	// Types holds link types such as "ether", "none" or "gre", or ARPHRD_* numbers
+	Types []string
+	// Drivers holds link kinds or device drivers such as "wireguard", "gre" or "veth"
+	Drivers []string
+	// OperStates holds operational states such as "up" or "unknown"
+	OperStates []string
+	// SkipUntestable drops interfaces that are down or whose link type cannot be tested
+	SkipUntestable bool
+	// Options are the test options. Ethernet links are only testable if they or a
+	// point-to-point subnet name the peer.
+	Options TestOptions
+	// BGPEstablished keeps only interfaces with an established BGP session in BIRD
+	BGPEstablished bool
+	BIRD           *BIRDClient
+}
+
+// ParseInterfacePatterns splits a comma-separated list of patterns. Patterns prefixed with "!"
+// are exclusions.
+func ParseInterfacePatterns(list string) (include []string, exclude []string) {
+	for _, pattern := range strings.Split(list, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if excluded, ok := strings.CutPrefix(pattern, "!"); ok {
+			exclude = append(exclude, excluded)
+		} else {
+			include = append(include, pattern)
+		}
+	}
+	return include, exclude
+}
+
+type interfaceMatcher struct {
+	pattern string
+	regex   *regexp.Regexp
+}
+
+func newInterfaceMatcher(pattern string) (interfaceMatcher, error) {
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		regex, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return interfaceMatcher{}, fmt.Errorf("invalid interface pattern %s: %s", pattern, err)
+		}
+		return interfaceMatcher{pattern: pattern, regex: regex}, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return interfaceMatcher{}, fmt.Errorf("invalid interface pattern %s: %s", pattern, err)
+	}
+	return interfaceMatcher{pattern: pattern}, nil
+}
+
+func (m interfaceMatcher) match(name string) bool {
+	if m.regex != nil {
+		return m.regex.MatchString(name)
+	}
+	matched, _ := path.Match(m.pattern, name)
+	return matched
+}
+
+func newInterfaceMatchers(patterns []string) ([]interfaceMatcher, error) {
+	matchers := make([]interfaceMatcher, 0, len(patterns))
+	for _, pattern := range patterns {
+		matcher, err := newInterfaceMatcher(pattern)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	}
+	return matchers, nil
+}
+
+// Select returns the selected interfaces in the order of intFaces, and the include patterns that
+// did not match any interface
+func (s *InterfaceSelector) Select(intFaces []net.Interface) (selected []net.Interface, unmatched []string, err error) {
+	include, err := newInterfaceMatchers(s.Include)
+	if err != nil {
+		return nil, nil, err
+	}
+	exclude, err := newInterfaceMatchers(s.Exclude)
+	if err != nil {
+		return nil, nil, err
+	}
+	types := make([]int, 0, len(s.Types))
+	for _, name := range s.Types {
+		hatype, ok := linkTypeNames[name]
+		if !ok {
+			if hatype, err = strconv.Atoi(name); err != nil {
+				return nil, nil, fmt.Errorf("unknown link type %s", name)
+			}
+		}
+		types = append(types, hatype)
+	}
+	var kinds map[int]string
+	if len(s.Drivers) != 0 {
+		if kinds, err = readLinkKinds(); err != nil {
+			return nil, nil, fmt.Errorf("could not read link kinds: %s", err)
+		}
+	}
+
+	var established map[string][]BGPSession
+	if s.BGPEstablished {
+		if s.BIRD == nil {
+			return nil, nil, fmt.Errorf("selecting established BGP sessions requires the BIRD control socket")
+		}
+		sessions, err := s.BIRD.Sessions()
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not read BGP sessions from BIRD: %s", err)
+		}
+		sessions = slices.DeleteFunc(slices.Clone(sessions), func(session BGPSession) bool { return !session.Established() })
+		established = SessionsByInterface(sessions, intFaces)
+	}
+
+	matchedInclude := make([]bool, len(include))
+	selected = make([]net.Interface, 0)
+	for _, intFace := range intFaces {
+		if len(include) != 0 {
+			included := false
+			for i, m := range include {
+				if m.match(intFace.Name) {
+					matchedInclude[i] = true
+					included = true
+				}
+			}
+			if !included {
+				continue
+			}
+		}
+		if slices.ContainsFunc(exclude, func(m interfaceMatcher) bool { return m.match(intFace.Name) }) {
+			continue
+		}
+
+		if len(types) != 0 || s.SkipUntestable {
+			hatype, err := interfaceType(&intFace)
+			if err != nil {
+				continue
+			}
+			if len(types) != 0 && !slices.Contains(types, hatype) {
+				continue
+			}
+			if s.SkipUntestable && untestable(&intFace, hatype, s.Options.ForInterface(intFace.Name)) {
+				continue
+			}
+		}
+		if len(s.Drivers) != 0 && !slices.Contains(s.Drivers, interfaceDriver(&intFace, kinds)) {
+			continue
+		}
+		if len(s.OperStates) != 0 && !slices.Contains(s.OperStates, interfaceOperState(&intFace)) {
+			continue
+		}
+		if s.BGPEstablished && len(established[intFace.Name]) == 0 {
+			continue
+		}
+		selected = append(selected, intFace)
+	}
+
+	for i, matched := range matchedInclude {
+		if !matched {
+			unmatched = append(unmatched, s.Include[i])
+		}
+	}
+	return selected, unmatched, nil
+}
+
+// untestable tells whether probes cannot be sent on an interface, because it is down, its link
+// type is not supported or its peer is unknown
+func untestable(intFace *net.Interface, hatype int, opts TestOptions) bool {
+	return intFace.Flags&net.FlagUp == 0 || checkLinkType(intFace, hatype, opts) != nil
+}
+
+func interfaceOperState(intFace *net.Interface) string {
+	state, err := os.ReadFile("/sys/class/net/" + intFace.Name + "/operstate")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(state))
+}
+
+// interfaceAlias returns the alias set with "ip link set <if> alias <text>"
+func interfaceAlias(intFace *net.Interface) string {
+	alias, err := os.ReadFile("/sys/class/net/" + intFace.Name + "/ifalias")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(alias))
+}
+
+// interfaceDriver returns the link kind of virtual interfaces, or the driver of the underlying device
+func interfaceDriver(intFace *net.Interface, kinds map[int]string) string {
+	if kind, ok := kinds[intFace.Index]; ok {
+		return kind
+	}
+	driver, err := os.Readlink("/sys/class/net/" + intFace.Name + "/device/driver")
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(driver)
+}
+
+// readLinkKinds returns the IFLA_INFO_KIND of all interfaces that have one, keyed by interface index
+func readLinkKinds() (map[int]string, error) {
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETLINK, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, err
+	}
+
+	kinds := make(map[int]string)
+	for _, m := range messages {
+		if m.Header.Type != syscall.RTM_NEWLINK || len(m.Data) < syscall.SizeofIfInfomsg {
+			continue
+		}
+		ifIndex := int(int32(binary.NativeEndian.Uint32(m.Data[4:8])))
+		linkInfo, ok := findAttribute(m.Data[syscall.SizeofIfInfomsg:], syscall.IFLA_LINKINFO)
+		if !ok {
+			continue
+		}
+		if kind, ok := findAttribute(linkInfo, iflaInfoKind); ok {
+			kinds[ifIndex] = strings.TrimRight(string(kind), "\x00")
+		}
+	}
+	return kinds, nil
+}
+
+// findAttribute returns the value of the first netlink attribute of the given type
+func findAttribute(attributes []byte, wantType uint16) ([]byte, bool) {
+	for len(attributes) >= syscall.SizeofRtAttr {
+		attrLen := int(binary.NativeEndian.Uint16(attributes[0:2]))
+		attrType := binary.NativeEndian.Uint16(attributes[2:4])
+		if attrLen < syscall.SizeofRtAttr || attrLen > len(attributes) {
+			break
+		}
+		// Strip NLA_F_NESTED and NLA_F_NET_BYTEORDER
+		if attrType&0x3fff == wantType {
+			return attributes[syscall.SizeofRtAttr:attrLen], true
+		}
+		attributes = attributes[min(rtaAlign(attrLen), len(attributes)):]
+	}
+	return nil, false
+}
@@ -0,0 +1,194 @@
+package peerTester
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestParseInterfacePatterns(t *testing.T) {
+	tests := []struct {
+		list        string
+		wantInclude []string
+		wantExclude []string
+	}{
+		{"", nil, nil},
+		{"dn42_*", []string{"dn42_*"}, nil},
+		{"dn42_*, wg0 ,!dn42_test", []string{"dn42_*", "wg0"}, []string{"dn42_test"}},
+		{"!/^docker/,,", nil, []string{"/^docker/"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			include, exclude := ParseInterfacePatterns(tt.list)
+			if !reflect.DeepEqual(include, tt.wantInclude) || !reflect.DeepEqual(exclude, tt.wantExclude) {
+				t.Errorf("ParseInterfacePatterns() = %q, %q, want %q, %q", include, exclude, tt.wantInclude, tt.wantExclude)
+			}
+		})
+	}
+}
+
+func TestInterfaceMatcher(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+		wantErr bool
+	}{
+		{"wg0", "wg0", true, false},
+		{"wg0", "wg01", false, false},
+		{"dn42_*", "dn42_kioubit", true, false},
+		{"dn42_?", "dn42_ab", false, false},
+		{"/^wg[0-9]+$/", "wg12", true, false},
+		{"/^wg[0-9]+$/", "wg1a", false, false},
+		{"/kioubit/", "dn42_kioubit_v6", true, false},
+		{"/", "/", true, false},
+		{"dn42_[", "", false, true},
+		{"/wg(/", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			matcher, err := newInterfaceMatcher(tt.pattern)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newInterfaceMatcher() error = %v, want error %t", err, tt.wantErr)
+			}
+			if err == nil && matcher.match(tt.name) != tt.want {
+				t.Errorf("match(%q) = %t, want %t", tt.name, !tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterfaceSelectorSelect(t *testing.T) {
+	intFaces := []net.Interface{{Index: 1, Name: "dn42_a"}, {Index: 2, Name: "dn42_b"}, {Index: 3, Name: "wg0"}, {Index: 4, Name: "docker0"}}
+	tests := []struct {
+		name          string
+		selector      InterfaceSelector
+		want          []string
+		wantUnmatched []string
+		wantErr       bool
+	}{
+		{"all", InterfaceSelector{}, []string{"dn42_a", "dn42_b", "wg0", "docker0"}, nil, false},
+		{"include", InterfaceSelector{Include: []string{"wg0", "dn42_*"}}, []string{"dn42_a", "dn42_b", "wg0"}, nil, false},
+		{"exclude", InterfaceSelector{Exclude: []string{"/^docker/", "dn42_b"}}, []string{"dn42_a", "wg0"}, nil, false},
+		{"exclude wins", InterfaceSelector{Include: []string{"dn42_*"}, Exclude: []string{"dn42_a"}}, []string{"dn42_b"}, nil, false},
+		{"unmatched include", InterfaceSelector{Include: []string{"wg*", "gre*"}}, []string{"wg0"}, []string{"gre*"}, false},
+		{"invalid include", InterfaceSelector{Include: []string{"["}}, nil, nil, true},
+		{"invalid exclude", InterfaceSelector{Exclude: []string{"/(/"}}, nil, nil, true},
+		{"unknown link type", InterfaceSelector{Types: []string{"token-ring"}}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, unmatched, err := tt.selector.Select(intFaces)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Select() error = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := make([]string, 0, len(selected))
+			for _, intFace := range selected {
+				got = append(got, intFace.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(unmatched, tt.wantUnmatched) {
+				t.Errorf("Select() = %v, %v, want %v, %v", got, unmatched, tt.want, tt.wantUnmatched)
+			}
+		})
+	}
+}
+
+func TestInterfaceSelectorTypes(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("no loopback interface")
+	}
+	// Interfaces whose type cannot be read are never selected by type
+	intFaces := []net.Interface{*lo, {Index: 1 << 30, Name: "pt-missing0"}}
+	tests := []struct {
+		types []string
+		want  []string
+	}{
+		{[]string{"loopback"}, []string{"lo"}},
+		{[]string{"772"}, []string{"lo"}},
+		{[]string{"ether", "none"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.types[0], func(t *testing.T) {
+			selector := &InterfaceSelector{Types: tt.types}
+			selected, _, err := selector.Select(intFaces)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(selected))
+			for _, intFace := range selected {
+				got = append(got, intFace.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Select() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUntestable(t *testing.T) {
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	peerMAC, _ := net.ParseMAC("02:00:00:00:00:02")
+	// The index does not exist, so the interfaces have no addresses and no point-to-point peer
+	tunnel := net.Interface{Index: 1 << 30, Name: "pt-missing0", Flags: net.FlagUp | net.FlagPointToPoint}
+	ether := net.Interface{Index: 1 << 30, Name: "pt-missing0", Flags: net.FlagUp, HardwareAddr: mac}
+	down := tunnel
+	down.Flags = 0
+	tests := []struct {
+		name    string
+		intFace net.Interface
+		hatype  int
+		opts    TestOptions
+		want    bool
+	}{
+		{"tunnel", tunnel, arphrdNone, TestOptions{}, false},
+		{"gre", tunnel, arphrdIpGre, TestOptions{}, false},
+		{"down", down, arphrdNone, TestOptions{}, true},
+		{"loopback", tunnel, 772, TestOptions{}, true},
+		{"ether without address", net.Interface{Name: "pt-missing0", Flags: net.FlagUp}, arphrdEther, TestOptions{PeerMAC: peerMAC}, true},
+		{"ether without peer", ether, arphrdEther, TestOptions{}, true},
+		{"ether with neighbor4", ether, arphrdEther, TestOptions{Neighbor4: net.ParseIP("172.20.0.1")}, false},
+		{"ether with neighbor6", ether, arphrdEther, TestOptions{Neighbor6: net.ParseIP("fe80::1")}, false},
+		{"ether with peer MAC", ether, arphrdEther, TestOptions{PeerMAC: peerMAC}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := untestable(&tt.intFace, tt.hatype, tt.opts); got != tt.want {
+				t.Errorf("untestable() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterfaceSelectorSkipUntestable(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("no loopback interface")
+	}
+	tests := []struct {
+		name     string
+		selector InterfaceSelector
+		want     []string
+	}{
+		{"not skipped", InterfaceSelector{}, []string{"lo"}},
+		{"loopback is untestable", InterfaceSelector{SkipUntestable: true}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, _, err := tt.selector.Select([]net.Interface{*lo})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(selected))
+			for _, intFace := range selected {
+				got = append(got, intFace.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Select() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package peerTester
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// LatencyStats summarizes the round trip times of all probes of one address family.
+// All values are in microseconds.
+type LatencyStats struct {
+	Min    float64
+	Max    float64
+	Mean   float64
+	Median float64
+	StdDev float64
+	// Jitter is the mean absolute difference between the RTTs of consecutive probes
+	Jitter float64
+	P95    float64
+}
+
+type latencySample struct {
+	id     uint8
+	rtt    time.Duration
+	kernel bool
+}
+
+func computeLatencyStats(samples []latencySample) *LatencyStats {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	// Consecutive probes are required for the jitter calculation
+	slices.SortFunc(samples, func(a, b latencySample) int {
+		return int(a.id) - int(b.id)
+	})
+
+	values := make([]float64, len(samples))
+	for i, sample := range samples {
+		values[i] = max(float64(sample.rtt)/float64(time.Microsecond), 0)
+	}
+
+	stats := &LatencyStats{}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	stats.Mean = sum / float64(len(values))
+
+	var variance float64
+	for _, v := range values {
+		variance += (v - stats.Mean) * (v - stats.Mean)
+	}
+	stats.StdDev = math.Sqrt(variance / float64(len(values)))
+
+	if len(values) > 1 {
+		var jitterSum float64
+		for i := 1; i < len(values); i++ {
+			jitterSum += math.Abs(values[i] - values[i-1])
+		}
+		stats.Jitter = jitterSum / float64(len(values)-1)
+	}
+
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	stats.Min = sorted[0]
+	stats.Max = sorted[len(sorted)-1]
+	if len(sorted)%2 == 0 {
+		stats.Median = (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	} else {
+		stats.Median = sorted[len(sorted)/2]
+	}
+	// Nearest-rank percentile
+	rank := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+	stats.P95 = sorted[max(rank, 0)]
+
+	return stats
+}
+
+func timestampSource(samples []latencySample) string {
+	var kernelCount int
+	for _, sample := range samples {
+		if sample.kernel {
+			kernelCount++
+		}
+	}
+	switch kernelCount {
+	case len(samples):
+		return TimestampKernel
+	case 0:
+		return TimestampUserspace
+	default:
+		return TimestampMixed
+	}
+}
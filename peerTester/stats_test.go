@@ -0,0 +1,51 @@
+package peerTester
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestComputeLatencyStats(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name    string
+		samples []latencySample
+		want    *LatencyStats
+	}{
+		{"no samples", nil, nil},
+		{"single sample", []latencySample{{id: 0, rtt: ms}},
+			&LatencyStats{Min: 1000, Max: 1000, Mean: 1000, Median: 1000, P95: 1000}},
+		{"unordered probes", []latencySample{{id: 2, rtt: 3 * ms}, {id: 0, rtt: ms}, {id: 1, rtt: 2 * ms}},
+			&LatencyStats{Min: 1000, Max: 3000, Mean: 2000, Median: 2000, StdDev: 816.497, Jitter: 1000, P95: 3000}},
+		{"even number of samples", []latencySample{{id: 0, rtt: ms}, {id: 1, rtt: 4 * ms}, {id: 2, rtt: 2 * ms}, {id: 3, rtt: 3 * ms}},
+			&LatencyStats{Min: 1000, Max: 4000, Mean: 2500, Median: 2500, StdDev: 1118.034, Jitter: 2000, P95: 4000}},
+		{"negative RTT is clamped", []latencySample{{id: 0, rtt: -5 * time.Microsecond}, {id: 1, rtt: 10 * time.Microsecond}},
+			&LatencyStats{Min: 0, Max: 10, Mean: 5, Median: 5, StdDev: 5, Jitter: 10, P95: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := computeLatencyStats(tt.samples)
+			if got == nil || tt.want == nil {
+				if got != tt.want {
+					t.Fatalf("computeLatencyStats() = %+v, want %+v", got, tt.want)
+				}
+				return
+			}
+			values := [][2]float64{
+				{got.Min, tt.want.Min},
+				{got.Max, tt.want.Max},
+				{got.Mean, tt.want.Mean},
+				{got.Median, tt.want.Median},
+				{got.StdDev, tt.want.StdDev},
+				{got.Jitter, tt.want.Jitter},
+				{got.P95, tt.want.P95},
+			}
+			for _, v := range values {
+				if math.Abs(v[0]-v[1]) > 0.001 {
+					t.Fatalf("computeLatencyStats() = %+v, want %+v", got, tt.want)
+				}
+			}
+		})
+	}
+}
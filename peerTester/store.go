@@ -0,0 +1,119 @@
+package peerTester
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// InterfaceState is the last known state of an interface
+type InterfaceState struct {
+	Result *IntFaceResult
+	// LastTested is the time the last test finished
+	LastTested time.Time
+	// LastChange is the time the status of either address family last changed
+	LastChange          time.Time
+	ConsecutiveFailures int
+}
+
+// StatusChangeFunc is called whenever the status of an interface changes.
+// previous is nil for the first result of an interface.
+type StatusChangeFunc func(name string, previous *IntFaceResult, state InterfaceState)
+
+// HistoryEntry is a past result of an interface
+type HistoryEntry struct {
+	Time   time.Time
+	Result *IntFaceResult
+}
+
+// historySize is the number of past results kept per interface
+const historySize = 100
+
+// ResultStore keeps the last result of every tested interface in memory
+type ResultStore struct {
+	OnStatusChange StatusChangeFunc
+
+	mu      sync.RWMutex
+	states  map[string]*InterfaceState
+	history map[string][]HistoryEntry
+}
+
+func NewResultStore() *ResultStore {
+	return &ResultStore{
+		states:  make(map[string]*InterfaceState),
+		history: make(map[string][]HistoryEntry),
+	}
+}
+
+// Record stores a new result and returns the updated state of the interface
+func (s *ResultStore) Record(name string, r *IntFaceResult) InterfaceState {
+	now := time.Now()
+	s.mu.Lock()
+	state, ok := s.states[name]
+	var previous *IntFaceResult
+	if !ok {
+		state = &InterfaceState{LastChange: now}
+		s.states[name] = state
+	} else {
+		previous = state.Result
+	}
+	changed := previous == nil || !previous.sameStatus(r)
+	if changed {
+		state.LastChange = now
+	}
+	state.Result = r
+	state.LastTested = now
+	if r.healthy() {
+		state.ConsecutiveFailures = 0
+	} else {
+		state.ConsecutiveFailures++
+	}
+	history := append(s.history[name], HistoryEntry{Time: now, Result: r})
+	if len(history) > historySize {
+		history = slices.Delete(history, 0, len(history)-historySize)
+	}
+	s.history[name] = history
+	snapshot := *state
+	s.mu.Unlock()
+
+	if changed && s.OnStatusChange != nil {
+		s.OnStatusChange(name, previous, snapshot)
+	}
+	return snapshot
+}
+
+// RecordAll stores the results of a complete test run
+func (s *ResultStore) RecordAll(resultMap map[string]*IntFaceResult) {
+	for name, r := range resultMap {
+		s.Record(name, r)
+	}
+}
+
+// State returns the last known state of an interface
+func (s *ResultStore) State(name string) (InterfaceState, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	state, ok := s.states[name]
+	if !ok {
+		return InterfaceState{}, false
+	}
+	return *state, true
+}
+
+// States returns the last known state of all interfaces that have been tested at least once
+func (s *ResultStore) States() map[string]InterfaceState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	states := make(map[string]InterfaceState, len(s.states))
+	for name, state := range s.states {
+		states[name] = *state
+	}
+	return states
+}
+
+// History returns the past results of an interface, oldest first
+func (s *ResultStore) History(name string) []HistoryEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.history[name])
+}
@@ -0,0 +1,127 @@
+package peerTester
+
+import (
+	"encoding/binary"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Timestamp sources reported in ListenResult.TimestampSource
+const (
+	TimestampKernel    = "kernel"
+	TimestampUserspace = "userspace"
+	TimestampMixed     = "mixed"
+)
+
+// Flags from linux/net_tstamp.h and linux/errqueue.h which are missing from the syscall package
+const (
+	sofTimestampingTxSoftware = 1 << 1
+	sofTimestampingSoftware   = 1 << 4
+	sofTimestampingOptID      = 1 << 7
+	sofTimestampingTxSched    = 1 << 8
+	sofTimestampingOptTsonly  = 1 << 11
+
+	packetTxTimestamp      = 16
+	soEeOriginTimestamping = 4
+	scmTstampSnd           = 0
+)
+
+// txTimestampWait is the maximum time to wait for the kernel to report the TX timestamp of a packet
+const txTimestampWait = time.Millisecond
+
+// enableTxTimestamps requests software TX timestamps on an AF_PACKET socket. The timestamps are
+// taken when the packet is handed to the device queue (SCHED) and when the driver transmits it (SND).
+// Every timestamp carries the number of the packet it belongs to, counted from 0 for the first
+// packet sent after this call.
+func enableTxTimestamps(fd int) error {
+	flags := sofTimestampingTxSched | sofTimestampingTxSoftware | sofTimestampingSoftware | sofTimestampingOptID | sofTimestampingOptTsonly
+	return syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_TIMESTAMPING, flags)
+}
+
+// readTxTimestamp reads the TX timestamp of packet number key sent on fd from the socket error queue.
+// The SND timestamp is preferred over the SCHED timestamp as it is closer to the time the packet left.
+// Timestamps of other packets, such as late ones of the previous packet, are dropped.
+func readTxTimestamp(fd int, key uint32) (time.Time, bool) {
+	var result time.Time
+	var found bool
+	var oob = make([]byte, 512)
+	var buf = make([]byte, 64)
+
+	deadline := time.Now().Add(txTimestampWait)
+	for time.Now().Before(deadline) {
+		_, oobn, _, _, err := syscall.Recvmsg(fd, buf, oob, syscall.MSG_ERRQUEUE|syscall.MSG_DONTWAIT)
+		if err != nil {
+			if err == syscall.EAGAIN || err == syscall.EINTR {
+				if found {
+					break
+				}
+				time.Sleep(50 * time.Microsecond)
+				continue
+			}
+			break
+		}
+		ts, tsType, tsKey, ok := parseTxTimestamp(oob[:oobn])
+		if !ok || tsKey != key {
+			continue
+		}
+		result, found = ts, true
+		if tsType == scmTstampSnd {
+			break
+		}
+	}
+	return result, found
+}
+
+// parseTxTimestamp returns the timestamp, its type and the number of the packet it belongs to
+func parseTxTimestamp(oobData []byte) (ts time.Time, tsType uint32, key uint32, ok bool) {
+	cMSGs, err := syscall.ParseSocketControlMessage(oobData)
+	if err != nil {
+		return time.Time{}, 0, 0, false
+	}
+	tsType = ^uint32(0)
+	for _, msg := range cMSGs {
+		switch {
+		case msg.Header.Level == syscall.SOL_SOCKET && msg.Header.Type == syscall.SCM_TIMESTAMPING:
+			// struct scm_timestamping: the first timespec holds the software timestamp
+			if len(msg.Data) < int(unsafe.Sizeof(syscall.Timespec{})) {
+				continue
+			}
+			spec := (*syscall.Timespec)(unsafe.Pointer(&msg.Data[0]))
+			if spec.Sec == 0 && spec.Nsec == 0 {
+				continue
+			}
+			ts, ok = time.Unix(spec.Unix()), true
+		case msg.Header.Level == syscall.SOL_PACKET && msg.Header.Type == packetTxTimestamp:
+			// struct sock_extended_err: ee_origin at offset 4, ee_info at offset 8, ee_data at offset 12
+			if len(msg.Data) < 16 || msg.Data[4] != soEeOriginTimestamping {
+				continue
+			}
+			tsType = binary.NativeEndian.Uint32(msg.Data[8:12])
+			key = binary.NativeEndian.Uint32(msg.Data[12:16])
+		}
+	}
+	return ts, tsType, key, ok
+}
+
+// enableRxTimestamps requests nanosecond receive timestamps on a socket
+func enableRxTimestamps(fd int) error {
+	return syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_TIMESTAMPNS, 1)
+}
+
+func parseOOBTimestamp(oobData []byte) (time.Time, bool) {
+	cMSGs, err := syscall.ParseSocketControlMessage(oobData)
+	if err != nil {
+		return time.Time{}, false
+	}
+	for _, msg := range cMSGs {
+		if msg.Header.Level == syscall.SOL_SOCKET && msg.Header.Type == syscall.SCM_TIMESTAMPNS {
+			if len(msg.Data) < int(unsafe.Sizeof(syscall.Timespec{})) {
+				continue
+			}
+			spec := (*syscall.Timespec)(unsafe.Pointer(&msg.Data[0]))
+			return time.Unix(spec.Unix()), true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,66 @@
+package peerTester
+
+import (
+	"encoding/binary"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// controlMessage returns a socket control message as received with recvmsg
+func controlMessage(level int, msgType int, data []byte) []byte {
+	b := make([]byte, syscall.CmsgSpace(len(data)))
+	header := (*syscall.Cmsghdr)(unsafe.Pointer(&b[0]))
+	header.Level = int32(level)
+	header.Type = int32(msgType)
+	header.SetLen(syscall.CmsgLen(len(data)))
+	copy(b[syscall.CmsgLen(0):], data)
+	return b
+}
+
+// txTimestampMessages returns the control messages of a TX timestamp of packet key
+func txTimestampMessages(ts time.Time, tsType uint32, key uint32) []byte {
+	specs := make([]byte, 3*unsafe.Sizeof(syscall.Timespec{}))
+	if !ts.IsZero() {
+		*(*syscall.Timespec)(unsafe.Pointer(&specs[0])) = syscall.NsecToTimespec(ts.UnixNano())
+	}
+	extendedErr := make([]byte, 16)
+	extendedErr[4] = soEeOriginTimestamping
+	binary.NativeEndian.PutUint32(extendedErr[8:12], tsType)
+	binary.NativeEndian.PutUint32(extendedErr[12:16], key)
+	return append(controlMessage(syscall.SOL_SOCKET, syscall.SCM_TIMESTAMPING, specs),
+		controlMessage(syscall.SOL_PACKET, packetTxTimestamp, extendedErr)...)
+}
+
+func TestParseTxTimestamp(t *testing.T) {
+	sent := time.Unix(1700000000, 123456789)
+	const scmTstampSched = 1
+	tests := []struct {
+		name     string
+		oob      []byte
+		wantType uint32
+		wantKey  uint32
+		wantOK   bool
+	}{
+		{"SND", txTimestampMessages(sent, scmTstampSnd, 7), scmTstampSnd, 7, true},
+		{"SCHED", txTimestampMessages(sent, scmTstampSched, 0), scmTstampSched, 0, true},
+		{"no timestamp", txTimestampMessages(time.Time{}, scmTstampSnd, 7), 0, 0, false},
+		{"no extended error", controlMessage(syscall.SOL_SOCKET, syscall.SCM_TIMESTAMPING, make([]byte, 48)), 0, 0, false},
+		{"empty", nil, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, tsType, key, ok := parseTxTimestamp(tt.oob)
+			if ok != tt.wantOK {
+				t.Fatalf("parseTxTimestamp() ok = %t, want %t", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if !ts.Equal(sent) || tsType != tt.wantType || key != tt.wantKey {
+				t.Errorf("parseTxTimestamp() = %s, %d, %d, want %s, %d, %d", ts, tsType, key, sent, tt.wantType, tt.wantKey)
+			}
+		})
+	}
+}
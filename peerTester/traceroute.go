@@ -0,0 +1,176 @@
+package peerTester
+
+import (
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// maxTraceHops is the highest TTL of traceroute probes
+const maxTraceHops = 16
+
+// Hop is a step on the path of the probes found by traceroute
+type Hop struct {
+	TTL int
+	// Address is the router that answered, or nil if no answer was received
+	Address net.IP
+	// RTTUs is the round trip time in microseconds, or -1 if no answer was received
+	RTTUs int64
+	// Destination is set if the probe reached the listener instead of expiring on the way
+	Destination bool
+}
+
+// traceFailures runs a traceroute for every address family that timed out or arrived with an
+// unexpected TTL
+func (t *Tester) traceFailures(intFace net.Interface, r *IntFaceResult, dstIp net.IP, dstIp6 net.IP, opts TestOptions) {
+	if opts.Destination4 != nil {
+		dstIp = opts.Destination4
+	}
+	if opts.Destination6 != nil {
+		dstIp6 = opts.Destination6
+	}
+
+	var wg sync.WaitGroup
+	for _, family := range []struct {
+		result  *ListenResult
+		sources []net.IP
+		dst     net.IP
+	}{{r.V4, opts.sources4(), dstIp}, {r.V6, opts.sources6(), dstIp6}} {
+		if len(family.sources) == 0 || family.dst == nil {
+			continue
+		}
+		if family.result.Status != Timeout && family.result.Status != UnexpectedTTL {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			family.result.Trace = t.traceroute(intFace, family.sources[0], family.dst, opts)
+		}()
+	}
+	wg.Wait()
+}
+
+// traceroute sends probes with increasing TTL and collects the ICMP Time Exceeded messages of
+// the routers on the way back to the listener
+func (t *Tester) traceroute(intFace net.Interface, source net.IP, dst net.IP, opts TestOptions) []Hop {
+	counter, c := t.dispatcher.register(2 * maxTraceHops)
+	defer t.dispatcher.unregister(counter)
+
+	sent, err := sendTraceProbes(intFace, source, dst, counter, opts)
+	if err != nil {
+		return nil
+	}
+
+	hops := make([]Hop, maxTraceHops)
+	for i := range hops {
+		hops[i] = Hop{TTL: i + 1, RTTUs: -1}
+	}
+	reached := 0
+	complete := func() bool {
+		if reached == 0 {
+			return false
+		}
+		for _, hop := range hops[:reached] {
+			if hop.Address == nil {
+				return false
+			}
+		}
+		return true
+	}
+
+	timeout := time.After(opts.Timeout)
+	for !complete() {
+		var result *ListenResult
+		select {
+		case result = <-c:
+		case <-timeout:
+		}
+		if result == nil {
+			break
+		}
+
+		// Tampered probes cannot be told apart from spoofed ones
+		if result.tampered {
+			continue
+		}
+		ttl := int(result.receiveTime.id)
+		if ttl < 1 || ttl > maxTraceHops || hops[ttl-1].Address != nil {
+			continue
+		}
+		hop := &hops[ttl-1]
+		if result.icmp == nil {
+			hop.Address = dst
+			hop.Destination = true
+			if reached == 0 || ttl < reached {
+				reached = ttl
+			}
+		} else if result.icmp.timeExceeded(result.isV4) {
+			hop.Address = result.icmp.from
+		} else {
+			continue
+		}
+		hop.RTTUs = result.receiveTime.time.Sub(sent[ttl-1]).Microseconds()
+	}
+
+	if reached != 0 {
+		return hops[:reached]
+	}
+	last := 0
+	for i, hop := range hops {
+		if hop.Address != nil {
+			last = i + 1
+		}
+	}
+	return hops[:last]
+}
+
+// sendTraceProbes sends one probe for every TTL up to maxTraceHops. The TTL is encoded in the
+// payload length, which is quoted by ICMP errors together with the UDP header.
+func sendTraceProbes(intFace net.Interface, source net.IP, dst net.IP, counter uint16, opts TestOptions) ([]time.Time, error) {
+	link, err := newLinkFraming(&intFace, opts)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := open(&intFace)
+	if err != nil {
+		return nil, err
+	}
+	defer func(fd int) {
+		_ = syscall.Close(fd)
+	}(conn)
+
+	isV4 := source.To4() != nil
+	sent := make([]time.Time, maxTraceHops)
+	for ttl := 1; ttl <= maxTraceHops; ttl++ {
+		// The payload is padded to encode the TTL in its length
+		contents := make([]byte, 4+ttl)
+		contents[0] = byte(counter >> 8)
+		contents[1] = byte(counter)
+		contents[3] = byte(ttl)
+		toSend := hmacSeal([16]byte(hmacKey), contents)
+
+		src := &net.UDPAddr{IP: source, Port: opts.sourcePort()}
+		ip := ipOptions{ttl: uint8(ttl), id: counter}
+		var b []byte
+		if isV4 {
+			b, err = buildUDPPacket(&net.UDPAddr{IP: dst, Port: opts.port}, src, toSend, ip)
+		} else {
+			b, err = buildUDPPacket6(&net.UDPAddr{IP: dst, Port: opts.port}, src, toSend, ip)
+		}
+		if err != nil {
+			return nil, err
+		}
+		b, err = link.frame(b, isV4)
+		if err != nil {
+			return nil, err
+		}
+		sent[ttl-1] = time.Now()
+		if err := syscall.Sendto(conn, b, 0, link.sockaddr(isV4)); err != nil {
+			return nil, err
+		}
+		time.Sleep(opts.ProbeInterval)
+	}
+	return sent, nil
+}